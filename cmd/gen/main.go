@@ -1,14 +1,20 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/strijmetkii/gen-isvalid/validation"
 )
 
+// errOutOfDate is returned in check mode when generated code differs from the output file
+var errOutOfDate = errors.New("generated code is out of date")
+
 func main() {
 	// Default input is the file that triggered go:generate
 	defaultInput := os.Getenv("GOFILE")
@@ -18,10 +24,69 @@ func main() {
 
 	// Parse flags
 	inputFile := flag.String("input", defaultInput, "Path to the input Go file")
+	dirFlag := flag.String("dir", "", "Package directory to generate isvalid_gen.go for, or a dir/... pattern")
 	outputFile := flag.String("output", "", "Path to the output Go file (default is <input>_gen.go)")
-	forceFlag := flag.Bool("force", false, "Force regeneration even if output file exists")
+	forceFlag := flag.Bool("force", false, "Force regeneration even if the output file is up to date")
+	typeCheckFlag := flag.Bool("typecheck", false, "Type-check the package to resolve field types")
+	checkFlag := flag.Bool("check", false, "Report a diff and fail if the output file is out of date, without writing it")
+	builderFlag := flag.Bool("builder", false, "Generate a builder for every struct")
+	styleFlag := flag.String("style", validation.StyleParams, "Constructor style of structs that don't select one: params or options")
 	flag.Parse()
 
+	// Configure a generator with the flags shared by every mode
+	configure := func(generator *validation.Generator) {
+		if *outputFile != "" {
+			generator.OutputFile = *outputFile
+		}
+
+		// Set force flag
+		generator.Force = *forceFlag
+
+		// Set type-check flag
+		generator.TypeCheck = *typeCheckFlag
+
+		// Set constructor style
+		generator.Style = *styleFlag
+
+		// Set builder flag
+		generator.Builder = *builderFlag
+	}
+
+	// Run a configured generator, or only compare its output in check mode
+	run := func(generator *validation.Generator, source string) error {
+		if !*checkFlag {
+			if err := generator.Generate(); err != nil {
+				return err
+			}
+			fmt.Printf("Successfully generated %s from %s\n", generator.OutputFile, source)
+			return nil
+		}
+
+		diff, err := generator.Check()
+		if err != nil {
+			return err
+		}
+		if diff != "" {
+			fmt.Print(diff)
+			return fmt.Errorf("%s: %w", generator.OutputFile, errOutOfDate)
+		}
+		fmt.Printf("%s is up to date\n", generator.OutputFile)
+		return nil
+	}
+
+	// Generate a file per package when a directory is given
+	if *dirFlag != "" {
+		if strings.HasSuffix(*dirFlag, "...") && *outputFile != "" {
+			fmt.Fprintln(os.Stderr, "Error: -output can't be combined with a dir/... pattern")
+			os.Exit(1)
+		}
+		if err := generateDirs(*dirFlag, configure, run); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// If the output file is not specified, derive it from the input file
 	if *outputFile == "" {
 		dir, filename := filepath.Split(*inputFile)
@@ -33,17 +98,66 @@ func main() {
 
 	// Create and run the generator
 	generator := validation.NewGenerator(*inputFile)
-	if *outputFile != "" {
-		generator.OutputFile = *outputFile
-	}
+	configure(generator)
 
-	// Set force flag
-	generator.Force = *forceFlag
-
-	if err := generator.Generate(); err != nil {
+	if err := run(generator, generator.InputFile); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+}
+
+// generateDirs runs a package generator for the given directory. A pattern
+// ending in /... covers every package below the directory, skipping those
+// without annotated structs. In check mode every package is checked before
+// reporting the output files that are out of date in a single error.
+func generateDirs(pattern string, configure func(*validation.Generator), run func(*validation.Generator, string) error) error {
+	root, recursive := strings.CutSuffix(filepath.ToSlash(pattern), "/...")
+	if !recursive {
+		return generateDir(pattern, configure, run)
+	}
+	if root == "" {
+		root = "."
+	}
+
+	var outOfDate []error
+	err := filepath.WalkDir(filepath.FromSlash(root), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		// Skip the directories ignored by the go tool
+		name := d.Name()
+		if path != root && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+
+		err = generateDir(path, configure, run)
+		switch {
+		case errors.Is(err, validation.ErrNoStructs):
+			return nil
+		case errors.Is(err, errOutOfDate):
+			outOfDate = append(outOfDate, err)
+			return nil
+		default:
+			return err
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(outOfDate...)
+}
+
+// generateDir runs a package generator for a single directory
+func generateDir(dir string, configure func(*validation.Generator), run func(*validation.Generator, string) error) error {
+	generator := validation.NewPackageGenerator(dir)
+	configure(generator)
 
-	fmt.Printf("Successfully generated %s from %s\n", generator.OutputFile, generator.InputFile)
+	if err := run(generator, generator.Dir); err != nil {
+		return fmt.Errorf("%s: %w", dir, err)
+	}
+	return nil
 }
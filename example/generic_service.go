@@ -1,10 +1,15 @@
 package example
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+//go:generate go run github.com/strijmetkii/gen-isvalid/cmd/gen -typecheck
 
 // GenericService is a service that works with a generic type
 //
-//go:generate go run github.com/strijmetkii/gen-isvalid/cmd/gen
+//isvalid:gen
 type GenericService[T any] struct {
 	Repository Repository[T]
 	Logger     Logger
@@ -25,14 +30,15 @@ type GenericOptions struct {
 	CacheTTL   int
 }
 
-// CacheService uses both generics and interfaces
+// CacheService uses both generics and interfaces, and can be built with a
+// builder
 //
-//go:generate go run github.com/strijmetkii/gen-isvalid/cmd/gen
+//isvalid:gen builder
 type CacheService[K comparable, V any] struct {
 	Store      KeyValueStore[K, V]
 	Serializer Serializer[V]
 	TTL        int
-	MaxSize    *int
+	MaxSize    *int //isvalid:optional
 }
 
 // KeyValueStore is a generic key-value store interface
@@ -50,12 +56,22 @@ type Serializer[T any] interface {
 
 // EventProcessor processes events with constraints on the generic type
 //
-//go:generate go run github.com/strijmetkii/gen-isvalid/cmd/gen
+//isvalid:gen
 type EventProcessor[E Event] struct {
 	Handler    EventHandler[E]
 	Queue      *EventQueue[E]
-	MaxWorkers int
+	MaxWorkers int `default:"4"`
 	Config     *ProcessorConfig
+
+	// workers limits the number of events handled at the same time
+	workers chan struct{}
+}
+
+// initialize sets up the worker pool of the EventProcessor, and is called by
+// the generated constructor
+func (p *EventProcessor[E]) initialize() error {
+	p.workers = make(chan struct{}, p.MaxWorkers)
+	return nil
 }
 
 // Event is an interface for all event types
@@ -80,3 +96,12 @@ type ProcessorConfig struct {
 	BatchSize   int
 	RetryPolicy string
 }
+
+// validateEventProcessorParams checks the invariants between the fields of the
+// EventProcessorParams, and is called by the generated validation
+func validateEventProcessorParams[E Event](params EventProcessorParams[E]) error {
+	if params.Config != nil && params.MaxWorkers > params.Config.BatchSize*2 {
+		return errors.New("MaxWorkers must be at most twice the BatchSize")
+	}
+	return nil
+}
@@ -1,9 +1,12 @@
-// Code generated by gen-isvalid.
+// Code generated by gen-isvalid. DO NOT EDIT.
+// Source hash: 9b955e9bf595bec23531b33fbebc8f20e17055d5629fa429727574b77b9e7e88
 
 package example
 
 import (
 	"errors"
+
+	"github.com/strijmetkii/gen-isvalid/isvalid"
 )
 
 // GenericServiceParams is the parameter struct for creating a GenericService
@@ -13,6 +16,11 @@ type GenericServiceParams[T any] struct {
 	Options    *GenericOptions
 }
 
+// Validate validates the GenericServiceParams, returning the errors of the invalid fields joined
+func (params GenericServiceParams[T]) Validate() error {
+	return isValidGenericServiceParams[T](params)
+}
+
 // NewGenericService creates a new GenericService
 func NewGenericService[T any](params GenericServiceParams[T]) (*GenericService[T], error) {
 	if err := isValidGenericServiceParams[T](params); err != nil {
@@ -29,8 +37,29 @@ func NewGenericService[T any](params GenericServiceParams[T]) (*GenericService[T
 // isValidGenericServiceParams validates the GenericServiceParams
 func isValidGenericServiceParams[T any](params GenericServiceParams[T]) error {
 	var errs []error
+	if params.Repository == nil {
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "GenericService",
+			Field:  "Repository",
+			Rule:   "required",
+			Value:  params.Repository,
+		})
+	}
+	if params.Logger == nil {
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "GenericService",
+			Field:  "Logger",
+			Rule:   "required",
+			Value:  params.Logger,
+		})
+	}
 	if params.Options == nil {
-		errs = append(errs, errors.New("Options is required"))
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "GenericService",
+			Field:  "Options",
+			Rule:   "required",
+			Value:  params.Options,
+		})
 	}
 	return errors.Join(errs...)
 }
@@ -43,6 +72,11 @@ type CacheServiceParams[K comparable, V any] struct {
 	MaxSize    *int
 }
 
+// Validate validates the CacheServiceParams, returning the errors of the invalid fields joined
+func (params CacheServiceParams[K, V]) Validate() error {
+	return isValidCacheServiceParams[K, V](params)
+}
+
 // NewCacheService creates a new CacheService
 func NewCacheService[K comparable, V any](params CacheServiceParams[K, V]) (*CacheService[K, V], error) {
 	if err := isValidCacheServiceParams[K, V](params); err != nil {
@@ -57,11 +91,74 @@ func NewCacheService[K comparable, V any](params CacheServiceParams[K, V]) (*Cac
 	}, nil
 }
 
+// CacheServiceBuilder builds a CacheService one field at a time
+type CacheServiceBuilder[K comparable, V any] struct {
+	params CacheServiceParams[K, V]
+}
+
+// NewCacheServiceBuilder creates a new CacheServiceBuilder
+func NewCacheServiceBuilder[K comparable, V any]() *CacheServiceBuilder[K, V] {
+	return &CacheServiceBuilder[K, V]{}
+}
+
+// SetStore sets the Store of the CacheService
+func (b *CacheServiceBuilder[K, V]) SetStore(value KeyValueStore[K, V]) *CacheServiceBuilder[K, V] {
+	b.params.Store = value
+	return b
+}
+
+// SetSerializer sets the Serializer of the CacheService
+func (b *CacheServiceBuilder[K, V]) SetSerializer(value Serializer[V]) *CacheServiceBuilder[K, V] {
+	b.params.Serializer = value
+	return b
+}
+
+// SetTTL sets the TTL of the CacheService
+func (b *CacheServiceBuilder[K, V]) SetTTL(value int) *CacheServiceBuilder[K, V] {
+	b.params.TTL = value
+	return b
+}
+
+// SetMaxSize sets the MaxSize of the CacheService
+func (b *CacheServiceBuilder[K, V]) SetMaxSize(value *int) *CacheServiceBuilder[K, V] {
+	b.params.MaxSize = value
+	return b
+}
+
+// Build validates the fields and creates the CacheService
+func (b *CacheServiceBuilder[K, V]) Build() (*CacheService[K, V], error) {
+	params := b.params
+
+	if err := isValidCacheServiceParams[K, V](params); err != nil {
+		return nil, err
+	}
+
+	return &CacheService[K, V]{
+		Store:      params.Store,
+		Serializer: params.Serializer,
+		TTL:        params.TTL,
+		MaxSize:    params.MaxSize,
+	}, nil
+}
+
 // isValidCacheServiceParams validates the CacheServiceParams
 func isValidCacheServiceParams[K comparable, V any](params CacheServiceParams[K, V]) error {
 	var errs []error
-	if params.MaxSize == nil {
-		errs = append(errs, errors.New("MaxSize is required"))
+	if params.Store == nil {
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "CacheService",
+			Field:  "Store",
+			Rule:   "required",
+			Value:  params.Store,
+		})
+	}
+	if params.Serializer == nil {
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "CacheService",
+			Field:  "Serializer",
+			Rule:   "required",
+			Value:  params.Serializer,
+		})
 	}
 	return errors.Join(errs...)
 }
@@ -74,28 +171,70 @@ type EventProcessorParams[E Event] struct {
 	Config     *ProcessorConfig
 }
 
+// Validate validates the EventProcessorParams, returning the errors of the invalid fields joined
+// The defaults are applied to a copy first, as the constructor does
+func (params EventProcessorParams[E]) Validate() error {
+	setEventProcessorParamsDefaults[E](&params)
+	return isValidEventProcessorParams[E](params)
+}
+
 // NewEventProcessor creates a new EventProcessor
 func NewEventProcessor[E Event](params EventProcessorParams[E]) (*EventProcessor[E], error) {
+	setEventProcessorParamsDefaults[E](&params)
+
 	if err := isValidEventProcessorParams[E](params); err != nil {
 		return nil, err
 	}
 
-	return &EventProcessor[E]{
+	s := &EventProcessor[E]{
 		Handler:    params.Handler,
 		Queue:      params.Queue,
 		MaxWorkers: params.MaxWorkers,
 		Config:     params.Config,
-	}, nil
+	}
+	if err := s.initialize(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// setEventProcessorParamsDefaults sets the fields of the EventProcessorParams that aren't set to their defaults
+func setEventProcessorParamsDefaults[E Event](params *EventProcessorParams[E]) {
+	if params.MaxWorkers == 0 {
+		params.MaxWorkers = 4
+	}
 }
 
 // isValidEventProcessorParams validates the EventProcessorParams
 func isValidEventProcessorParams[E Event](params EventProcessorParams[E]) error {
 	var errs []error
+	if params.Handler == nil {
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "EventProcessor",
+			Field:  "Handler",
+			Rule:   "required",
+			Value:  params.Handler,
+		})
+	}
 	if params.Queue == nil {
-		errs = append(errs, errors.New("Queue is required"))
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "EventProcessor",
+			Field:  "Queue",
+			Rule:   "required",
+			Value:  params.Queue,
+		})
 	}
 	if params.Config == nil {
-		errs = append(errs, errors.New("Config is required"))
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "EventProcessor",
+			Field:  "Config",
+			Rule:   "required",
+			Value:  params.Config,
+		})
+	}
+	if err := validateEventProcessorParams[E](params); err != nil {
+		errs = append(errs, err)
 	}
 	return errors.Join(errs...)
 }
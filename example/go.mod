@@ -1,3 +1,7 @@
 module example
 
 go 1.24.2
+
+require github.com/strijmetkii/gen-isvalid v0.0.0
+
+replace github.com/strijmetkii/gen-isvalid => ../
@@ -1,20 +1,25 @@
 package example
 
-// ExampleService is a service for interacting with the example API
+//go:generate go run github.com/strijmetkii/gen-isvalid/cmd/gen -typecheck
+
+// ExampleService is a service for interacting with the example API, built
+// from functional options
 //
-//go:generate go run github.com/strijmetkii/gen-isvalid/cmd/gen
+//isvalid:gen style=options
 type ExampleService struct {
 	Client *Client
 	Cfg    *Config
 }
 
-// AnotherService is another example service
+// AnotherService is another example service, which can validate itself
 //
-//go:generate go run github.com/strijmetkii/gen-isvalid/cmd/gen
+//isvalid:gen validate
 type AnotherService struct {
 	Logger  Logger
 	Options Options
-	Timeout int
+	Timeout int `validate:"min=1,max=300"`
+	// Replicas are the options of the read replicas by name
+	Replicas map[string]*Options `validate:"optional,dive,keys,min_len=2,endkeys"`
 }
 
 // Logger is a simple logging interface
@@ -24,9 +29,12 @@ type Logger interface {
 	Error(msg string)
 }
 
-// Options represents configuration options
+// Options represents configuration options, validated along with the
+// services holding them
+//
+//isvalid:gen validate
 type Options struct {
-	Region   string
+	Region   string `validate:"required"`
 	Endpoint string
 }
 
@@ -1,9 +1,13 @@
-// Code generated by gen-isvalid.
+// Code generated by gen-isvalid. DO NOT EDIT.
+// Source hash: 80e8d49e000d39234d5eead3ad8f9e899c640008d39882c3c8c9e7b2d0299843
 
 package example
 
 import (
 	"errors"
+	"fmt"
+
+	"github.com/strijmetkii/gen-isvalid/isvalid"
 )
 
 // ExampleServiceParams is the parameter struct for creating a ExampleService
@@ -12,8 +16,35 @@ type ExampleServiceParams struct {
 	Cfg    *Config
 }
 
-// NewExampleService creates a new ExampleService
-func NewExampleService(params ExampleServiceParams) (*ExampleService, error) {
+// Validate validates the ExampleServiceParams, returning the errors of the invalid fields joined
+func (params ExampleServiceParams) Validate() error {
+	return isValidExampleServiceParams(params)
+}
+
+// ExampleServiceOption sets a field of the ExampleServiceParams
+type ExampleServiceOption func(*ExampleServiceParams)
+
+// WithClient sets the Client of a ExampleService
+func WithClient(value *Client) ExampleServiceOption {
+	return func(params *ExampleServiceParams) {
+		params.Client = value
+	}
+}
+
+// WithCfg sets the Cfg of a ExampleService
+func WithCfg(value *Config) ExampleServiceOption {
+	return func(params *ExampleServiceParams) {
+		params.Cfg = value
+	}
+}
+
+// NewExampleService creates a new ExampleService from the given options
+func NewExampleService(opts ...ExampleServiceOption) (*ExampleService, error) {
+	var params ExampleServiceParams
+	for _, opt := range opts {
+		opt(&params)
+	}
+
 	if err := isValidExampleServiceParams(params); err != nil {
 		return nil, err
 	}
@@ -28,19 +59,45 @@ func NewExampleService(params ExampleServiceParams) (*ExampleService, error) {
 func isValidExampleServiceParams(params ExampleServiceParams) error {
 	var errs []error
 	if params.Client == nil {
-		errs = append(errs, errors.New("Client is required"))
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "ExampleService",
+			Field:  "Client",
+			Rule:   "required",
+			Value:  params.Client,
+		})
 	}
 	if params.Cfg == nil {
-		errs = append(errs, errors.New("Cfg is required"))
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "ExampleService",
+			Field:  "Cfg",
+			Rule:   "required",
+			Value:  params.Cfg,
+		})
 	}
 	return errors.Join(errs...)
 }
 
 // AnotherServiceParams is the parameter struct for creating a AnotherService
 type AnotherServiceParams struct {
-	Logger  Logger
-	Options Options
-	Timeout int
+	Logger   Logger
+	Options  Options
+	Timeout  int
+	Replicas map[string]*Options
+}
+
+// Validate validates the AnotherServiceParams, returning the errors of the invalid fields joined
+func (params AnotherServiceParams) Validate() error {
+	return isValidAnotherServiceParams(params)
+}
+
+// Validate validates the fields of the AnotherService like its constructor does
+func (s *AnotherService) Validate() error {
+	var params AnotherServiceParams
+	params.Logger = s.Logger
+	params.Options = s.Options
+	params.Timeout = s.Timeout
+	params.Replicas = s.Replicas
+	return isValidAnotherServiceParams(params)
 }
 
 // NewAnotherService creates a new AnotherService
@@ -50,14 +107,113 @@ func NewAnotherService(params AnotherServiceParams) (*AnotherService, error) {
 	}
 
 	return &AnotherService{
-		Logger:  params.Logger,
-		Options: params.Options,
-		Timeout: params.Timeout,
+		Logger:   params.Logger,
+		Options:  params.Options,
+		Timeout:  params.Timeout,
+		Replicas: params.Replicas,
 	}, nil
 }
 
 // isValidAnotherServiceParams validates the AnotherServiceParams
 func isValidAnotherServiceParams(params AnotherServiceParams) error {
 	var errs []error
+	if params.Logger == nil {
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "AnotherService",
+			Field:  "Logger",
+			Rule:   "required",
+			Value:  params.Logger,
+		})
+	}
+	if err := params.Options.Validate(); err != nil {
+		errs = append(errs, isvalid.WithPath("Options", err))
+	}
+	if params.Timeout < 1 {
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "AnotherService",
+			Field:  "Timeout",
+			Rule:   "min",
+			Param:  "1",
+			Value:  params.Timeout,
+		})
+	}
+	if params.Timeout > 300 {
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "AnotherService",
+			Field:  "Timeout",
+			Rule:   "max",
+			Param:  "300",
+			Value:  params.Timeout,
+		})
+	}
+	for key, elem := range params.Replicas {
+		if len(key) < 2 {
+			errs = append(errs, &isvalid.FieldError{
+				Struct: "AnotherService",
+				Field:  fmt.Sprintf("Replicas[%q]", key),
+				Rule:   "min_len",
+				Param:  "2",
+				Value:  key,
+			})
+		}
+		if elem == nil {
+			errs = append(errs, &isvalid.FieldError{
+				Struct: "AnotherService",
+				Field:  fmt.Sprintf("Replicas[%q]", key),
+				Rule:   "required",
+				Value:  elem,
+			})
+		}
+		if elem != nil {
+			if err := elem.Validate(); err != nil {
+				errs = append(errs, isvalid.WithPath(fmt.Sprintf("Replicas[%q]", key), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// OptionsParams is the parameter struct for creating a Options
+type OptionsParams struct {
+	Region   string
+	Endpoint string
+}
+
+// Validate validates the OptionsParams, returning the errors of the invalid fields joined
+func (params OptionsParams) Validate() error {
+	return isValidOptionsParams(params)
+}
+
+// Validate validates the fields of the Options like its constructor does
+func (s *Options) Validate() error {
+	var params OptionsParams
+	params.Region = s.Region
+	params.Endpoint = s.Endpoint
+	return isValidOptionsParams(params)
+}
+
+// NewOptions creates a new Options
+func NewOptions(params OptionsParams) (*Options, error) {
+	if err := isValidOptionsParams(params); err != nil {
+		return nil, err
+	}
+
+	return &Options{
+		Region:   params.Region,
+		Endpoint: params.Endpoint,
+	}, nil
+}
+
+// isValidOptionsParams validates the OptionsParams
+func isValidOptionsParams(params OptionsParams) error {
+	var errs []error
+	if params.Region == "" {
+		errs = append(errs, &isvalid.FieldError{
+			Struct: "Options",
+			Field:  "Region",
+			Rule:   "required",
+			Value:  params.Region,
+		})
+	}
 	return errors.Join(errs...)
 }
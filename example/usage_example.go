@@ -94,11 +94,27 @@ func UsageExample() {
 
 	fmt.Printf("Created cache service with TTL: %d\n", cacheService.TTL)
 
+	// The same CacheService built with the generated builder
+	builtCache, err := NewCacheServiceBuilder[string, interface{}]().
+		SetStore(&MemoryStore[string, interface{}]{}).
+		SetSerializer(&JsonSerializer[interface{}]{}).
+		SetTTL(120).
+		Build()
+	if err != nil {
+		fmt.Printf("Error building cache service: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Built cache service with TTL: %d\n", builtCache.TTL)
+
 	// Example 4: Using AnotherService with ConsoleLogger
 	anotherService, err := NewAnotherService(AnotherServiceParams{
 		Logger:  ConsoleLogger{},
 		Options: Options{Region: "us-west-2", Endpoint: "https://api.example.com"},
 		Timeout: 60,
+		Replicas: map[string]*Options{
+			"eu": {Region: "eu-west-1", Endpoint: "https://eu.api.example.com"},
+		},
 	})
 	if err != nil {
 		fmt.Printf("Error creating another service: %v\n", err)
@@ -106,6 +122,18 @@ func UsageExample() {
 	}
 
 	fmt.Printf("Created another service with timeout: %d\n", anotherService.Timeout)
+
+	// Example 5: Using ExampleService with functional options
+	exampleService, err := NewExampleService(
+		WithClient(&Client{}),
+		WithCfg(&Config{}),
+	)
+	if err != nil {
+		fmt.Printf("Error creating example service: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Created example service with client: %v\n", exampleService.Client)
 }
 
 // Additional implementations for the example
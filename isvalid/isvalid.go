@@ -0,0 +1,155 @@
+// Package isvalid holds the types used by the code generated by gen-isvalid.
+// Generated constructors report every invalid field as a *FieldError, joined
+// with errors.Join, so callers can inspect them with errors.As and match the
+// failed rule with errors.Is:
+//
+//	service, err := NewExampleService(params)
+//	if errors.Is(err, isvalid.ErrRequired) {
+//		// A required field is missing
+//	}
+package isvalid
+
+import (
+	"errors"
+	"strings"
+)
+
+// Sentinel errors for the validation rules, matched by the field errors of
+// the corresponding rule
+var (
+	// ErrRequired is matched by fields that are required but not set
+	ErrRequired = errors.New("required")
+	// ErrMin is matched by numbers below their minimum
+	ErrMin = errors.New("min")
+	// ErrMax is matched by numbers above their maximum
+	ErrMax = errors.New("max")
+	// ErrLen is matched by values without the required length
+	ErrLen = errors.New("len")
+	// ErrMinLen is matched by values shorter than their minimum length
+	ErrMinLen = errors.New("min_len")
+	// ErrMaxLen is matched by values longer than their maximum length
+	ErrMaxLen = errors.New("max_len")
+	// ErrOneOf is matched by values that aren't one of the allowed values
+	ErrOneOf = errors.New("oneof")
+	// ErrRegexp is matched by strings that don't match their pattern
+	ErrRegexp = errors.New("regexp")
+)
+
+// ruleErrors maps the rule names to their sentinel errors
+var ruleErrors = map[string]error{
+	"required": ErrRequired,
+	"min":      ErrMin,
+	"max":      ErrMax,
+	"len":      ErrLen,
+	"min_len":  ErrMinLen,
+	"max_len":  ErrMaxLen,
+	"oneof":    ErrOneOf,
+	"regexp":   ErrRegexp,
+}
+
+// FieldError reports a field that failed a validation rule
+type FieldError struct {
+	// Struct is the name of the struct being constructed
+	Struct string
+	// Field is the name of the invalid field
+	Field string
+	// Rule is the name of the failed rule, such as required or min
+	Rule string
+	// Param is the parameter of the rule, empty if it takes none
+	Param string
+	// Value is the value of the field
+	Value any
+}
+
+// Error returns a description of the failed rule, such as "Timeout must be at
+// least 1"
+func (e *FieldError) Error() string {
+	switch e.Rule {
+	case "required":
+		return e.Field + " is required"
+	case "min":
+		return e.Field + " must be at least " + e.Param
+	case "max":
+		return e.Field + " must be at most " + e.Param
+	case "len":
+		return e.Field + " must have length " + e.Param
+	case "min_len":
+		return e.Field + " must have length at least " + e.Param
+	case "max_len":
+		return e.Field + " must have length at most " + e.Param
+	case "oneof":
+		return e.Field + " must be one of " + strings.Join(strings.Fields(e.Param), ", ")
+	case "regexp":
+		return e.Field + " must match " + e.Param
+	default:
+		return e.Field + " is invalid"
+	}
+}
+
+// Unwrap returns the sentinel error of the failed rule, nil for unknown rules
+func (e *FieldError) Unwrap() error {
+	return ruleErrors[e.Rule]
+}
+
+// PathError is an error of a nested value that isn't a *FieldError, such as
+// the error of a hand-written Validate method
+type PathError struct {
+	// Path is the path of the nested value, such as Options or Backends["eu"]
+	Path string
+	// Err is the error of the nested value
+	Err error
+}
+
+// Error returns the error prefixed with the path
+func (e *PathError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error of the nested value
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// WithPath returns err with the field errors it holds moved below the given
+// path, so a field Region of a nested value at path Options becomes
+// Options.Region. Errors joined with errors.Join are handled one by one, and
+// other errors are wrapped in a *PathError. It returns nil if err is nil.
+func WithPath(path string, err error) error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *FieldError:
+		nested := *e
+		nested.Field = joinPath(path, e.Field)
+		return &nested
+	case *PathError:
+		return &PathError{Path: joinPath(path, e.Path), Err: e.Err}
+	case interface{ Unwrap() []error }:
+		errs := e.Unwrap()
+		nested := make([]error, 0, len(errs))
+		for _, err := range errs {
+			nested = append(nested, WithPath(path, err))
+		}
+		return errors.Join(nested...)
+	default:
+		return &PathError{Path: path, Err: err}
+	}
+}
+
+// joinPath appends a field or index to a path. Indexes such as [0] follow
+// the path directly, while fields are separated by a dot.
+func joinPath(path, elem string) string {
+	if strings.HasPrefix(elem, "[") {
+		return path + elem
+	}
+	return path + "." + elem
+}
+
+// Validator is implemented by the generated Params structs, and by the
+// structs that ask for a generated Validate method, so generic code can
+// validate them without knowing their type
+type Validator interface {
+	// Validate returns the errors of the invalid fields joined, or nil if
+	// every field is valid
+	Validate() error
+}
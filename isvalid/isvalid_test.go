@@ -0,0 +1,76 @@
+package isvalid
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFieldError(t *testing.T) {
+	tests := []struct {
+		err      *FieldError
+		message  string
+		sentinel error
+	}{
+		{&FieldError{Field: "Client", Rule: "required"}, "Client is required", ErrRequired},
+		{&FieldError{Field: "Timeout", Rule: "min", Param: "1"}, "Timeout must be at least 1", ErrMin},
+		{&FieldError{Field: "Timeout", Rule: "max", Param: "300"}, "Timeout must be at most 300", ErrMax},
+		{&FieldError{Field: "Code", Rule: "len", Param: "2"}, "Code must have length 2", ErrLen},
+		{&FieldError{Field: "Name", Rule: "min_len", Param: "1"}, "Name must have length at least 1", ErrMinLen},
+		{&FieldError{Field: "Name", Rule: "max_len", Param: "64"}, "Name must have length at most 64", ErrMaxLen},
+		{&FieldError{Field: "Mode", Rule: "oneof", Param: "fast slow"}, "Mode must be one of fast, slow", ErrOneOf},
+		{&FieldError{Field: "Region", Rule: "regexp", Param: "^[a-z]+$"}, "Region must match ^[a-z]+$", ErrRegexp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.message {
+				t.Errorf("Error() = %q, want %q", got, tt.message)
+			}
+
+			// Joined errors still match the sentinel and the field error
+			err := errors.Join(errors.New("other"), tt.err)
+			if !errors.Is(err, tt.sentinel) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.sentinel)
+			}
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) || fieldErr != tt.err {
+				t.Errorf("errors.As(%v) didn't find the field error", err)
+			}
+		})
+	}
+}
+
+func TestWithPath(t *testing.T) {
+	region := &FieldError{Struct: "Options", Field: "Region", Rule: "required"}
+	other := errors.New("endpoint is unreachable")
+	err := WithPath("Options", errors.Join(region, other))
+
+	want := "Options.Region is required\nOptions: endpoint is unreachable"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	// The original errors still match
+	if !errors.Is(err, ErrRequired) || !errors.Is(err, other) {
+		t.Errorf("errors.Is(%v) doesn't match the nested errors", err)
+	}
+
+	// The nested field error is a copy with the full path
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "Options.Region" {
+		t.Errorf("errors.As(%v) didn't find the nested field error", err)
+	}
+	if region.Field != "Region" {
+		t.Errorf("WithPath() modified the nested field error")
+	}
+
+	// Indexes follow the path directly
+	err = WithPath("Backends", WithPath(`["eu"]`, &FieldError{Field: "URL", Rule: "required"}))
+	if want := `Backends["eu"].URL is required`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	if WithPath("Options", nil) != nil {
+		t.Errorf("WithPath() of nil isn't nil")
+	}
+}
@@ -0,0 +1,179 @@
+package validation
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// Dive holds the validation of the elements of a slice, array or map field,
+// declared by the rules that follow dive in the validate tag
+type Dive struct {
+	// Index is the variable holding the index or key of an element
+	Index string
+	// Path is the Go expression of the path of an element, such as
+	// fmt.Sprintf("Handlers[%d]", i)
+	Path string
+	// Checks are the conditions validated for the elements, held in elem
+	Checks []Check
+	// KeyChecks are the conditions validated for the keys of a map, held in key
+	KeyChecks []Check
+	// Nested indicates if the elements have a Validate method
+	Nested bool
+	// Nilable indicates if the elements can be nil, in which case their
+	// Validate method is only called when they are set
+	Nilable bool
+
+	// elemExpr is the type of the elements, nil for type parameters
+	elemExpr ast.Expr
+	// elemKind classifies the type of the elements
+	elemKind FieldKind
+}
+
+// UsesElem reports whether the elements themselves are validated, rather than
+// only the keys of a map
+func (d *Dive) UsesElem() bool {
+	return len(d.Checks) > 0 || d.Nested
+}
+
+// splitDive splits the rules of a field at the dive rule. The rules before it
+// apply to the field, and those after it to the elements. For maps, the rules
+// between keys and endkeys right after dive apply to the keys.
+func splitDive(rules []Rule) (field, keys, elems []Rule, dive bool, err error) {
+	for i, rule := range rules {
+		switch rule.Name {
+		case "dive":
+			field, elems, dive = rules[:i], rules[i+1:], true
+		case "keys", "endkeys":
+			return nil, nil, nil, false, fmt.Errorf("rule %s must follow dive", rule.Name)
+		default:
+			continue
+		}
+		break
+	}
+	if !dive {
+		return rules, nil, nil, false, nil
+	}
+
+	if len(elems) > 0 && elems[0].Name == "keys" {
+		end := -1
+		for i, rule := range elems {
+			if rule.Name == "endkeys" {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, nil, nil, false, fmt.Errorf("rule keys requires a matching endkeys")
+		}
+		keys, elems = elems[1:end], elems[end+1:]
+	}
+
+	for _, rules := range [][]Rule{keys, elems} {
+		for _, rule := range rules {
+			switch rule.Name {
+			case "dive":
+				return nil, nil, nil, false, fmt.Errorf("nested dive is not supported")
+			case "keys", "endkeys":
+				return nil, nil, nil, false, fmt.Errorf("rule %s must follow dive", rule.Name)
+			}
+		}
+	}
+	return field, keys, elems, true, nil
+}
+
+// buildDive builds the validation of the elements of a field with the given
+// type, which must be a slice, array or map, or a type declared as one in the
+// package. Nilable elements and keys are required unless marked optional,
+// as fields are.
+func buildDive(s *StructInfo, f FieldInfo, expr ast.Expr, keyRules, elemRules []Rule, resolver *kindResolver, typeParamNames map[string]bool) (*Dive, error) {
+	keyExpr, elemExpr := diveTypes(expr, resolver, typeParamNames)
+	if elemExpr == nil {
+		return nil, fmt.Errorf("rule dive applies to slices, arrays and maps, not %s", f.Kind)
+	}
+	if keyExpr == nil && len(keyRules) > 0 {
+		return nil, fmt.Errorf("rule keys applies to maps, not %s", f.Kind)
+	}
+
+	elem, err := diveField(s, f.Name+"_elem", elemExpr, elemRules, resolver, typeParamNames)
+	if err != nil {
+		return nil, err
+	}
+	dive := &Dive{
+		Index:    "i",
+		Path:     fmt.Sprintf("fmt.Sprintf(%q, i)", f.Name+"[%d]"),
+		Nilable:  elem.Kind.Nilable(),
+		elemKind: elem.Kind,
+	}
+	if ident, ok := elemExpr.(*ast.Ident); !ok || !typeParamNames[ident.Name] {
+		dive.elemExpr = elemExpr
+	}
+	if dive.Checks, err = buildChecks(s, elem, "elem"); err != nil {
+		return nil, fmt.Errorf("dive: %w", err)
+	}
+	s.refs.collect(elemExpr, resolver, typeParamNames)
+
+	if keyExpr != nil {
+		key, err := diveField(s, f.Name+"_key", keyExpr, keyRules, resolver, typeParamNames)
+		if err != nil {
+			return nil, err
+		}
+		verb := "%v"
+		if key.Kind == KindString {
+			verb = "%q"
+		}
+		dive.Index = "key"
+		dive.Path = fmt.Sprintf("fmt.Sprintf(%q, key)", f.Name+"["+verb+"]")
+		if dive.KeyChecks, err = buildChecks(s, key, "key"); err != nil {
+			return nil, fmt.Errorf("keys: %w", err)
+		}
+		s.refs.collect(keyExpr, resolver, typeParamNames)
+	}
+
+	return dive, nil
+}
+
+// diveField returns the field describing the keys or elements of a field, whose
+// name is used for the patterns of their checks
+func diveField(s *StructInfo, name string, expr ast.Expr, rules []Rule, resolver *kindResolver, typeParamNames map[string]bool) (FieldInfo, error) {
+	elemType, err := extractType(expr)
+	if err != nil {
+		return FieldInfo{}, err
+	}
+	f := FieldInfo{
+		Name:  name,
+		Type:  elemType,
+		Kind:  resolver.kindOf(expr, typeParamNames),
+		Rules: rules,
+	}
+	if !f.Kind.Nilable() {
+		f.incomparable = !resolver.comparable(expr, s.constraints)
+	}
+	f.basic = resolver.basicInfo(expr, typeParamNames)
+	return f, nil
+}
+
+// diveTypes returns the types of the keys and elements of a slice, array or
+// map type, following the types declared in the package. The key is nil
+// for slices and arrays, and both are nil for other types.
+func diveTypes(expr ast.Expr, resolver *kindResolver, typeParamNames map[string]bool) (key, elem ast.Expr) {
+	seen := make(map[string]bool)
+	for {
+		switch t := expr.(type) {
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.ArrayType:
+			return nil, t.Elt
+		case *ast.MapType:
+			return t.Key, t.Value
+		case *ast.Ident:
+			def, ok := resolver.decls[t.Name]
+			if !ok || typeParamNames[t.Name] || seen[t.Name] {
+				return nil, nil
+			}
+			seen[t.Name] = true
+			expr = def
+		default:
+			return nil, nil
+		}
+	}
+}
@@ -2,27 +2,64 @@ package validation
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/format"
 	"go/parser"
 	"go/token"
+	"go/types"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"text/template"
 )
 
+// packageOutputFile is the name of the output file when generating for a whole package
+const packageOutputFile = "isvalid_gen.go"
+
+// ErrNoStructs is returned when the input contains no structs to generate code for
+var ErrNoStructs = errors.New("no structs marked with isvalid:gen found")
+
+// generateMarker is the comment that marks a struct for generation
+const generateMarker = "//isvalid:gen"
+
+// toolName identifies the go:generate directives that run this generator
+const toolName = "gen-isvalid"
+
+// Constructor styles, selected for every struct with Generator.Style or for a
+// single struct with a style argument of its marker, such as
+// //isvalid:gen style=options
+const (
+	// StyleParams generates a constructor taking a Params struct
+	StyleParams = "params"
+	// StyleOptions generates a constructor taking functional options, with a
+	// With<Field> option for every field of the Params struct
+	StyleOptions = "options"
+)
+
 // Generator manages the validation code generation process
 type Generator struct {
 	// InputFile is the path to the input Go file
 	InputFile string
+	// Dir is the package directory whose files are all scanned instead of InputFile
+	Dir string
 	// OutputFile is the path to the output generated code file
 	OutputFile string
 	// PackageName is the name of the package for the generated code
 	PackageName string
-	// Force indicates whether to force regeneration even if output file exists
+	// Force indicates whether to force regeneration even if the output file is up to date
 	Force bool
+	// TypeCheck indicates whether to type-check the package of the input file
+	// to resolve field types, instead of relying on the syntax of the file alone
+	TypeCheck bool
+	// Style is the constructor style of the structs that don't select one in
+	// their marker, StyleParams if empty
+	Style string
+	// Builder indicates whether to generate a builder for every struct, which
+	// a single struct enables with the builder argument of its marker
+	Builder bool
 }
 
 // StructInfo contains information about a struct for which validation code will be generated
@@ -35,18 +72,152 @@ type StructInfo struct {
 	PackageName string
 	// TypeParams are the type parameters of the struct if it's generic
 	TypeParams string
+	// TypeArgs are the names of the type parameters, which instantiate the
+	// generic types with the parameters of the struct
+	TypeArgs string
 	// IsGeneric indicates if the struct is a generic type
 	IsGeneric bool
+	// Patterns are the regular expressions used to validate the fields
+	Patterns []Pattern
+	// Style is the style of the generated constructor
+	Style string
+	// Builder indicates if a <Name>Builder with a Set<Field> method for every
+	// field of the Params struct is generated
+	Builder bool
+	// ValidateStruct indicates if a Validate method is generated for the
+	// struct itself, besides the one of its Params struct
+	ValidateStruct bool
+	// IncludeUnexported indicates if the unexported fields of the struct are
+	// included in the Params struct, as if they had the include option
+	IncludeUnexported bool
+	// ParamsHook indicates if the package declares a validate<Name>Params
+	// function, whose error is joined with those of the fields
+	ParamsHook bool
+	// ValidateMethod indicates if the struct declares a Validate method,
+	// which the constructor calls once the fields are valid and the struct
+	// is built
+	ValidateMethod bool
+	// InitHook indicates if the struct declares an initialize method, which
+	// the constructor calls to set up derived state once the struct is built
+	// and valid
+	InitHook bool
+
+	// file is the file declaring the struct
+	file *ast.File
+	// refs are the packages and identifiers referred to by the field types
+	refs typeRefs
+	// constraints maps the type parameters of the struct to their constraints
+	constraints map[string]ast.Expr
 }
 
 // FieldInfo contains information about a struct field
 type FieldInfo struct {
-	// Name is the name of the field
+	// Name is the name of the field in the Params struct
 	Name string
+	// FieldName is the name of the field in the struct, which differs from
+	// Name for included unexported fields
+	FieldName string
 	// Type is the type of the field
 	Type string
-	// IsPointer indicates if the field is a pointer type
-	IsPointer bool
+	// Kind classifies the type of the field
+	Kind FieldKind
+	// Rules are the validation rules from the validate tag of the field
+	Rules []Rule
+	// Checks are the conditions validated for the field
+	Checks []Check
+	// Embedded indicates if the field is embedded, in which case Name is the name of its type
+	Embedded bool
+	// Flatten indicates if the exported fields of an embedded struct replace it in the Params struct
+	Flatten bool
+	// Flattened are the fields of a flattened embedded struct
+	Flattened []FieldInfo
+	// Literal is the composite literal type that builds a flattened embedded
+	// struct, prefixed with & for pointers
+	Literal string
+	// Default is the value assigned to the field when it isn't set, nil if
+	// the field has no default
+	Default *Default
+	// Nested indicates if the field holds a value with a Validate method,
+	// whose errors are reported below the name of the field
+	Nested bool
+	// Dive is the validation of the elements of the field, nil unless its
+	// rules dive into them
+	Dive *Dive
+
+	// typeExpr is the type of the field, nil for type parameters
+	typeExpr ast.Expr
+	// incomparable indicates if the field can't be compared with its zero
+	// value, which rules out the checks and defaults that need to
+	incomparable bool
+	// basic holds the properties of the basic type of the field, 0 if it
+	// isn't a basic type or can't be resolved
+	basic types.BasicInfo
+}
+
+// ParamFields returns the fields of the Params struct, which are the fields of
+// the struct with flattened embedded structs replaced by their own fields
+func (s StructInfo) ParamFields() []FieldInfo {
+	return paramFields(s.Fields)
+}
+
+// FieldSource is a field of the Params struct along with the expression that
+// reads it from the struct
+type FieldSource struct {
+	// Name is the name of the field in the Params struct
+	Name string
+	// Expr is the Go expression that reads the field from the struct s
+	Expr string
+	// Guard is the condition under which Expr can be evaluated, empty if it
+	// always can. Fields of flattened embedded pointers can only be read when
+	// the pointers are set.
+	Guard string
+}
+
+// FieldSources returns the fields of the Params struct with the expressions
+// that read them from the struct
+func (s StructInfo) FieldSources() []FieldSource {
+	return fieldSources(s.Fields, "s", nil)
+}
+
+func fieldSources(fields []FieldInfo, prefix string, guards []string) []FieldSource {
+	var result []FieldSource
+	for _, field := range fields {
+		expr := prefix + "." + field.FieldName
+		if !field.Flatten {
+			result = append(result, FieldSource{Name: field.Name, Expr: expr, Guard: strings.Join(guards, " && ")})
+			continue
+		}
+
+		nested := guards
+		if strings.HasPrefix(field.Literal, "&") {
+			nested = append(guards[:len(guards):len(guards)], expr+" != nil")
+		}
+		result = append(result, fieldSources(field.Flattened, expr, nested)...)
+	}
+	return result
+}
+
+// DefaultFields returns the fields of the Params struct that have a default
+func (s StructInfo) DefaultFields() []FieldInfo {
+	var result []FieldInfo
+	for _, field := range s.ParamFields() {
+		if field.Default != nil {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+func paramFields(fields []FieldInfo) []FieldInfo {
+	var result []FieldInfo
+	for _, field := range fields {
+		if field.Flatten {
+			result = append(result, paramFields(field.Flattened)...)
+		} else {
+			result = append(result, field)
+		}
+	}
+	return result
 }
 
 // NewGenerator creates a new generator for the given input file
@@ -61,29 +232,183 @@ func NewGenerator(inputFile string) *Generator {
 	}
 }
 
-// Generate parses the input file and generates the validation code
+// NewPackageGenerator creates a new generator for every file of the package in
+// the given directory, writing a single consolidated output file
+func NewPackageGenerator(dir string) *Generator {
+	return &Generator{
+		Dir:        dir,
+		OutputFile: filepath.Join(dir, packageOutputFile),
+	}
+}
+
+// Generate parses the input files and generates the validation code
 func (g *Generator) Generate() error {
-	// Check if output file already exists and Force is not set
-	if !g.Force {
-		if _, err := os.Stat(g.OutputFile); err == nil {
-			// File exists, skip generation
-			fmt.Printf("Output file %s already exists, skipping generation\n", g.OutputFile)
-			return nil
-		}
+	hash, code, err := g.render()
+	if err != nil {
+		return err
 	}
 
-	// Parse the input file
+	// Skip writing if the output was generated from the same definitions and
+	// Force is not set
+	if !g.Force && readHash(g.OutputFile) == hash {
+		fmt.Printf("Output file %s is up to date, skipping generation\n", g.OutputFile)
+		return nil
+	}
+
+	// Write the code to the output file
+	err = os.WriteFile(g.OutputFile, code, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+
+	return nil
+}
+
+// Check generates the validation code in memory and compares it with the
+// output file without writing anything. It returns a unified diff from the
+// output file to the generated code, which is empty if the output file is up
+// to date.
+func (g *Generator) Check() (string, error) {
+	_, code, err := g.render()
+	if err != nil {
+		return "", err
+	}
+
+	current, err := os.ReadFile(g.OutputFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("reading output file: %w", err)
+	}
+
+	return unifiedDiff(g.OutputFile, g.OutputFile+" (generated)", string(current), string(code)), nil
+}
+
+// render parses the input files and returns the source hash and the
+// formatted validation code
+func (g *Generator) render() (string, []byte, error) {
+	if g.Style != "" && g.Style != StyleParams && g.Style != StyleOptions {
+		return "", nil, fmt.Errorf("unknown constructor style %q", g.Style)
+	}
+
+	// Parse the input files
 	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, g.InputFile, nil, parser.ParseComments)
+	var files []*ast.File
+	if g.Dir != "" {
+		var err error
+		files, err = parseDir(fset, g.Dir, g.OutputFile)
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		node, err := parser.ParseFile(fset, g.InputFile, nil, parser.ParseComments)
+		if err != nil {
+			return "", nil, fmt.Errorf("parsing file: %w", err)
+		}
+		files = append(files, node)
+	}
+
+	if len(files) > 0 {
+		g.PackageName = files[0].Name.Name
+	}
+	for _, file := range files {
+		if file.Name.Name != g.PackageName {
+			return "", nil, fmt.Errorf("found packages %s and %s in %s", g.PackageName, file.Name.Name, g.Dir)
+		}
+	}
+
+	// In single file mode the rest of the package still needs to be loaded
+	// for type checking and to find the hooks of the structs
+	pkgFiles := files
+	if g.Dir == "" {
+		others, err := parseDir(fset, filepath.Dir(g.InputFile), g.InputFile, g.OutputFile)
+		if err != nil {
+			return "", nil, fmt.Errorf("loading package: %w", err)
+		}
+		for _, other := range others {
+			if other.Name.Name == g.PackageName {
+				pkgFiles = append(pkgFiles, other)
+			}
+		}
+	}
+
+	// Types and names are resolved against the whole package, while only the
+	// structs of the input files are generated
+	resolver := newKindResolver(pkgFiles)
+	if g.TypeCheck {
+		resolver.info = checkPackage(fset, g.PackageName, pkgFiles)
+	}
+
+	// Find structs marked for generation
+	var structs []StructInfo
+	for _, file := range files {
+		fileStructs, err := g.extractStructs(fset, file, resolver)
+		if err != nil {
+			return "", nil, err
+		}
+		structs = append(structs, fileStructs...)
+	}
+
+	if len(structs) == 0 {
+		return "", nil, ErrNoStructs
+	}
+
+	// The structs marked in the other files of the package are generated by
+	// other runs with the same flags, whose declarations can't be repeated.
+	// Errors in those files are left for their own runs to report.
+	var others []StructInfo
+	for _, file := range pkgFiles[len(files):] {
+		fileStructs, err := g.extractStructs(fset, file, resolver)
+		if err == nil {
+			others = append(others, fileStructs...)
+		}
+	}
+
+	if err := checkOptionNames(structs, others, resolver); err != nil {
+		return "", nil, err
+	}
+
+	if err := checkPatternNames(structs, others, resolver); err != nil {
+		return "", nil, err
+	}
+
+	decls := newFuncDecls(pkgFiles)
+	if err := findHooks(fset, structs, decls); err != nil {
+		return "", nil, err
+	}
+	findNested(structs, others, decls, resolver.info)
+
+	imports, err := resolveImports(structs, pkgFiles, resolver.info)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Record the hash of the definitions in the header
+	data := g.templateData(imports, structs)
+	hash, err := sourceHash(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("hashing definitions: %w", err)
+	}
+	data["Hash"] = hash
+
+	// Generate the code
+	code, err := g.generateCode(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("generating code: %w", err)
+	}
+
+	// Format the code
+	formattedCode, err := format.Source([]byte(code))
 	if err != nil {
-		return fmt.Errorf("parsing file: %w", err)
+		return "", nil, fmt.Errorf("formatting generated code: %w", err)
 	}
 
-	g.PackageName = node.Name.Name
+	return hash, formattedCode, nil
+}
 
-	// Find structs with the go:generate comment
+// extractStructs extracts the structs marked for generation from the given
+// file. Positions in errors are reported relative to fset.
+func (g *Generator) extractStructs(fset *token.FileSet, file *ast.File, resolver *kindResolver) ([]StructInfo, error) {
 	var structs []StructInfo
-	for _, decl := range node.Decls {
+	for _, decl := range file.Decls {
 		genDecl, ok := decl.(*ast.GenDecl)
 		if !ok || genDecl.Tok != token.TYPE {
 			continue
@@ -100,17 +425,32 @@ func (g *Generator) Generate() error {
 				continue
 			}
 
-			// Check if the struct has our go:generate directive
-			if !hasGenerateDirective(genDecl.Doc) {
-				continue
+			// Check if the struct is marked for generation, on its own or on
+			// the declaration when it isn't part of a group
+			doc := typeSpec.Doc
+			if !hasGenerateDirective(doc) {
+				if genDecl.Lparen.IsValid() || !hasGenerateDirective(genDecl.Doc) {
+					continue
+				}
+				doc = genDecl.Doc
 			}
 
 			// Check for type parameters (generics)
-			typeParams := ""
+			typeParams, typeArgs := "", ""
 			isGeneric := false
+			typeParamNames := make(map[string]bool)
 			if typeSpec.TypeParams != nil && len(typeSpec.TypeParams.List) > 0 {
 				isGeneric = true
-				typeParams = extractTypeParams(typeSpec.TypeParams)
+				var err error
+				typeParams, typeArgs, err = extractTypeParams(typeSpec.TypeParams)
+				if err != nil {
+					return nil, fmt.Errorf("%s: struct %s: %w", fset.Position(typeSpec.TypeParams.Pos()), typeSpec.Name.Name, err)
+				}
+				for _, param := range typeSpec.TypeParams.List {
+					for _, name := range param.Names {
+						typeParamNames[name.Name] = true
+					}
+				}
 			}
 
 			// Extract struct info
@@ -119,135 +459,307 @@ func (g *Generator) Generate() error {
 				PackageName: g.PackageName,
 				Fields:      make([]FieldInfo, 0, len(structType.Fields.List)),
 				TypeParams:  typeParams,
+				TypeArgs:    typeArgs,
 				IsGeneric:   isGeneric,
+				Style:       g.Style,
+				Builder:     g.Builder,
+				file:        file,
+			}
+			if structInfo.Style == "" {
+				structInfo.Style = StyleParams
+			}
+
+			// Apply the arguments of the marker
+			for _, arg := range markerArgs(doc) {
+				switch arg.Name {
+				case "style":
+					if arg.Param != StyleParams && arg.Param != StyleOptions {
+						return nil, fmt.Errorf("struct %s: unknown constructor style %q", structInfo.Name, arg.Param)
+					}
+					structInfo.Style = arg.Param
+				case "builder":
+					if arg.Param != "" {
+						return nil, fmt.Errorf("struct %s: marker argument builder takes no value", structInfo.Name)
+					}
+					structInfo.Builder = true
+				case "validate":
+					if arg.Param != "" {
+						return nil, fmt.Errorf("struct %s: marker argument validate takes no value", structInfo.Name)
+					}
+					structInfo.ValidateStruct = true
+				case "unexported":
+					if arg.Param != "" {
+						return nil, fmt.Errorf("struct %s: marker argument unexported takes no value", structInfo.Name)
+					}
+					structInfo.IncludeUnexported = true
+				default:
+					return nil, fmt.Errorf("struct %s: unknown marker argument %q", structInfo.Name, arg.Name)
+				}
+			}
+			if typeSpec.TypeParams != nil {
+				structInfo.constraints = make(map[string]ast.Expr)
+				for _, param := range typeSpec.TypeParams.List {
+					structInfo.refs.collect(param.Type, resolver, typeParamNames)
+					for _, name := range param.Names {
+						structInfo.constraints[name.Name] = param.Type
+					}
+				}
 			}
 
 			// Extract field info
-			for _, field := range structType.Fields.List {
-				if len(field.Names) == 0 {
-					// Skip embedded fields
-					continue
+			fields, err := g.extractFields(fset, &structInfo, structType.Fields, resolver, typeParamNames, map[string]bool{structInfo.Name: true})
+			if err != nil {
+				return nil, err
+			}
+			structInfo.Fields = fields
+
+			// Flattened fields share the Params struct with the other fields,
+			// which also has a Validate method
+			seen := map[string]bool{"Validate": true}
+			for _, field := range structInfo.ParamFields() {
+				if seen[field.Name] {
+					return nil, fmt.Errorf("field %s.%s: duplicate field or method in %sParams", structInfo.Name, field.Name, structInfo.Name)
 				}
+				seen[field.Name] = true
+			}
 
-				fieldName := field.Names[0].Name
+			structs = append(structs, structInfo)
+		}
+	}
 
-				// Skip unexported fields
-				if !ast.IsExported(fieldName) {
+	return structs, nil
+}
+
+// extractFields extracts the exported fields of a struct type, skipping those
+// with the - option. Embedded fields are named after their type, unless they
+// hold a lock or aren't comparable, and embedded structs with the flatten
+// option are replaced by their own fields. The names of the structs being flattened are
+// tracked in flattening to stop on recursive embedding.
+func (g *Generator) extractFields(fset *token.FileSet, s *StructInfo, fields *ast.FieldList, resolver *kindResolver, typeParamNames, flattening map[string]bool) ([]FieldInfo, error) {
+	var result []FieldInfo
+	for _, field := range fields.List {
+		names := field.Names
+		embedded := len(names) == 0
+		if embedded {
+			names = []*ast.Ident{ast.NewIdent(embeddedName(field.Type))}
+		}
+
+		// A declaration like A, B *Client declares a field for every name
+		for _, name := range names {
+			fieldName := name.Name
+			if fieldName == "_" {
+				continue
+			}
+
+			options, err := parseRules(field.Tag, optionsTag)
+			if err != nil {
+				return nil, fmt.Errorf("field %s.%s: %w", s.Name, fieldName, err)
+			}
+
+			// Skip excluded fields, and embedded values the Params struct
+			// can't hold: the constructor would copy a lock such as a
+			// sync.Mutex, and the zero checks need a comparable type
+			if hasRule(options, "-") {
+				if len(options) > 1 {
+					return nil, fmt.Errorf("field %s.%s: option - can't be combined with other options", s.Name, fieldName)
+				}
+				continue
+			}
+			if embedded && !hasRule(options, "flatten") &&
+				(resolver.holdsLock(field.Type) || !resolver.comparable(field.Type, s.constraints)) {
+				continue
+			}
+
+			// Skip unexported fields, unless they are included in the Params
+			// struct under an exported name
+			paramName := fieldName
+			if !ast.IsExported(fieldName) {
+				if !s.IncludeUnexported && !hasRule(options, "include") {
 					continue
 				}
+				paramName = upperFirst(fieldName)
+				if !ast.IsExported(paramName) {
+					return nil, fmt.Errorf("field %s.%s: name can't be exported in %sParams", s.Name, fieldName, s.Name)
+				}
+			}
 
-				fieldType := ""
-				isPointer := false
+			rules, err := parseRules(field.Tag, validateTag)
+			if err != nil {
+				return nil, fmt.Errorf("field %s.%s: %w", s.Name, fieldName, err)
+			}
+			rules, keyRules, elemRules, dive, err := splitDive(rules)
+			if err != nil {
+				return nil, fmt.Errorf("field %s.%s: %w", s.Name, fieldName, err)
+			}
+			if hasOptionalMarker(field) {
+				rules = append(rules, Rule{Name: "optional"})
+			}
 
-				// Check if the field is a pointer
-				switch t := field.Type.(type) {
-				case *ast.StarExpr:
-					isPointer = true
-					// Get the underlying type
-					fieldType = extractType(t.X)
+			defaultValue, hasDefault, err := lookupTag(field.Tag, defaultTag)
+			if err != nil {
+				return nil, fmt.Errorf("field %s.%s: %w", s.Name, fieldName, err)
+			}
+
+			fieldType, err := extractType(field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s: field %s.%s: %w", fset.Position(field.Type.Pos()), s.Name, fieldName, err)
+			}
+			if resolver.info != nil {
+				if err := checkArrayLens(field.Type, resolver.info); err != nil {
+					return nil, fmt.Errorf("%s: field %s.%s: %w", fset.Position(field.Type.Pos()), s.Name, fieldName, err)
+				}
+			}
+
+			fieldInfo := FieldInfo{
+				Name:      paramName,
+				FieldName: fieldName,
+				Type:      fieldType,
+				Kind:      resolver.kindOf(field.Type, typeParamNames),
+				Rules:     rules,
+				Embedded:  embedded,
+			}
+			if ident, ok := field.Type.(*ast.Ident); !ok || !typeParamNames[ident.Name] {
+				fieldInfo.typeExpr = field.Type
+			}
+			if !fieldInfo.Kind.Nilable() {
+				fieldInfo.incomparable = !resolver.comparable(field.Type, s.constraints)
+			}
+			fieldInfo.basic = resolver.basicInfo(field.Type, typeParamNames)
+
+			for _, option := range options {
+				switch option.Name {
+				case "flatten":
+					if !embedded {
+						return nil, fmt.Errorf("field %s.%s: option flatten applies to embedded fields", s.Name, fieldName)
+					}
+					if len(rules) > 0 || dive {
+						return nil, fmt.Errorf("field %s.%s: flattened fields can't have validation rules", s.Name, fieldName)
+					}
+					fieldInfo.Flatten = true
+				case "include":
+					if ast.IsExported(fieldName) {
+						return nil, fmt.Errorf("field %s.%s: option include applies to unexported fields", s.Name, fieldName)
+					}
+				case "default":
+					if hasDefault {
+						return nil, fmt.Errorf("field %s.%s: default is set by both the %s tag and the %s option", s.Name, fieldName, defaultTag, optionsTag)
+					}
+					defaultValue, hasDefault = option.Param, true
 				default:
-					fieldType = extractType(field.Type)
+					return nil, fmt.Errorf("field %s.%s: unknown option %q", s.Name, fieldName, option.Name)
 				}
+			}
 
-				structInfo.Fields = append(structInfo.Fields, FieldInfo{
-					Name:      fieldName,
-					Type:      fieldType,
-					IsPointer: isPointer,
-				})
+			if fieldInfo.Flatten {
+				if hasDefault {
+					return nil, fmt.Errorf("field %s.%s: flattened fields can't have a default", s.Name, fieldName)
+				}
+				fieldInfo.Literal, fieldInfo.Flattened, err = g.flattenEmbedded(fset, s, field.Type, resolver, typeParamNames, flattening)
+				if err != nil {
+					return nil, fmt.Errorf("field %s.%s: %w", s.Name, fieldName, err)
+				}
+				result = append(result, fieldInfo)
+				continue
 			}
 
-			structs = append(structs, structInfo)
+			// Record the packages the field type refers to, which are imported
+			// by the generated code. Flattened structs are replaced by their
+			// fields, so only the types of those fields need to be imported.
+			s.refs.collect(field.Type, resolver, typeParamNames)
+
+			if hasDefault {
+				fieldInfo.Default, err = buildDefault(fieldInfo, defaultValue)
+				if err != nil {
+					return nil, fmt.Errorf("%s: field %s.%s: %w", fset.Position(field.Pos()), s.Name, fieldName, err)
+				}
+				// The default may refer to other packages as well
+				expr, _ := parser.ParseExpr(fieldInfo.Default.Value)
+				s.refs.collect(expr, resolver, typeParamNames)
+			}
+
+			fieldInfo.Checks, err = buildChecks(s, fieldInfo, "params."+fieldInfo.Name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: field %s.%s: %w", fset.Position(field.Pos()), s.Name, fieldName, err)
+			}
+			if dive {
+				fieldInfo.Dive, err = buildDive(s, fieldInfo, field.Type, keyRules, elemRules, resolver, typeParamNames)
+				if err != nil {
+					return nil, fmt.Errorf("%s: field %s.%s: %w", fset.Position(field.Pos()), s.Name, fieldName, err)
+				}
+			}
+
+			result = append(result, fieldInfo)
 		}
 	}
 
-	if len(structs) == 0 {
-		return fmt.Errorf("no structs with go:generate directive found")
-	}
+	return result, nil
+}
 
-	// Generate the code
-	code, err := g.generateCode(structs)
-	if err != nil {
-		return fmt.Errorf("generating code: %w", err)
+// flattenEmbedded extracts the fields of an embedded struct declared in the
+// package. It returns the composite literal type that builds the embedded
+// struct, prefixed with & for pointers, along with the fields.
+func (g *Generator) flattenEmbedded(fset *token.FileSet, s *StructInfo, expr ast.Expr, resolver *kindResolver, typeParamNames, flattening map[string]bool) (string, []FieldInfo, error) {
+	literal := ""
+	if star, ok := expr.(*ast.StarExpr); ok {
+		literal = "&"
+		expr = star.X
 	}
 
-	// Format the code
-	formattedCode, err := format.Source([]byte(code))
-	if err != nil {
-		return fmt.Errorf("formatting generated code: %w", err)
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return "", nil, fmt.Errorf("only non-generic structs declared in the package can be flattened")
 	}
-
-	// Write the code to the output file
-	err = os.WriteFile(g.OutputFile, formattedCode, 0o644)
-	if err != nil {
-		return fmt.Errorf("writing output file: %w", err)
+	structType, ok := resolver.decls[ident.Name].(*ast.StructType)
+	if !ok {
+		return "", nil, fmt.Errorf("struct %s is not declared in the package", ident.Name)
+	}
+	if flattening[ident.Name] {
+		return "", nil, fmt.Errorf("struct %s embeds itself", ident.Name)
 	}
 
-	return nil
-}
+	flattening[ident.Name] = true
+	defer delete(flattening, ident.Name)
 
-// extractTypeParams extracts the type parameters from a type parameter list
-func extractTypeParams(typeParams *ast.FieldList) string {
-	var params []string
-	for _, param := range typeParams.List {
-		for _, name := range param.Names {
-			paramType := extractType(param.Type)
-			params = append(params, name.Name+" "+paramType)
-		}
+	fields, err := g.extractFields(fset, s, structType.Fields, resolver, typeParamNames, flattening)
+	if err != nil {
+		return "", nil, err
 	}
-	return "[" + strings.Join(params, ", ") + "]"
+	return literal + ident.Name, fields, nil
 }
 
-// extractType extracts the type string from an AST expression
-func extractType(expr ast.Expr) string {
+// embeddedName returns the implicit name of an embedded field, which is the
+// name of its type without pointer, package qualifier and type arguments
+func embeddedName(expr ast.Expr) string {
 	switch t := expr.(type) {
 	case *ast.Ident:
 		return t.Name
-	case *ast.SelectorExpr:
-		pkg := t.X.(*ast.Ident).Name
-		sel := t.Sel.Name
-		return pkg + "." + sel
 	case *ast.StarExpr:
-		return "*" + extractType(t.X)
-	case *ast.ArrayType:
-		if t.Len == nil {
-			return "[]" + extractType(t.Elt)
-		}
-		return "[" + extractArrayLen(t.Len) + "]" + extractType(t.Elt)
-	case *ast.MapType:
-		return "map[" + extractType(t.Key) + "]" + extractType(t.Value)
-	case *ast.InterfaceType:
-		return "interface{}"
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
 	case *ast.IndexExpr:
-		return extractType(t.X) + "[" + extractType(t.Index) + "]"
+		return embeddedName(t.X)
 	case *ast.IndexListExpr:
-		var indices []string
-		for _, index := range t.Indices {
-			indices = append(indices, extractType(index))
-		}
-		return extractType(t.X) + "[" + strings.Join(indices, ", ") + "]"
-	default:
-		return fmt.Sprintf("%T", expr)
-	}
-}
-
-// extractArrayLen extracts the length of an array from an AST expression
-func extractArrayLen(expr ast.Expr) string {
-	switch t := expr.(type) {
-	case *ast.BasicLit:
-		return t.Value
+		return embeddedName(t.X)
 	default:
 		return ""
 	}
 }
 
-// hasGenerateDirective checks if the comment group contains our go:generate directive
+// hasGenerateDirective checks if the comment group contains our isvalid:gen
+// marker, or a go:generate directive that runs this generator. Directives of
+// other tools are ignored.
 func hasGenerateDirective(commentGroup *ast.CommentGroup) bool {
 	if commentGroup == nil {
 		return false
 	}
 
 	for _, comment := range commentGroup.List {
-		if strings.Contains(comment.Text, "//go:generate") {
+		text := strings.TrimSpace(comment.Text)
+		if text == generateMarker || strings.HasPrefix(text, generateMarker+" ") {
+			return true
+		}
+		if strings.HasPrefix(text, "//go:generate ") && strings.Contains(text, toolName) {
 			return true
 		}
 	}
@@ -255,8 +767,95 @@ func hasGenerateDirective(commentGroup *ast.CommentGroup) bool {
 	return false
 }
 
-// generateCode generates the validation code for the given structs
-func (g *Generator) generateCode(structs []StructInfo) (string, error) {
+// markerArgs returns the arguments that follow the isvalid:gen marker in the
+// comment group. Arguments are separated by spaces, and parameters follow an
+// equals sign.
+func markerArgs(commentGroup *ast.CommentGroup) []Rule {
+	if commentGroup == nil {
+		return nil
+	}
+
+	var args []Rule
+	for _, comment := range commentGroup.List {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(comment.Text), generateMarker+" ")
+		if !ok {
+			continue
+		}
+		for _, word := range strings.Fields(rest) {
+			name, param, _ := strings.Cut(word, "=")
+			args = append(args, Rule{Name: name, Param: param})
+		}
+	}
+	return args
+}
+
+// checkOptionNames checks that the With<Field> options generated for structs
+// with the options style are unique and don't clash with declarations of the
+// package, including the options generated for the other structs of the
+// package
+func checkOptionNames(structs, others []StructInfo, resolver *kindResolver) error {
+	owners := make(map[string]string)
+	for _, s := range others {
+		if s.Style != StyleOptions {
+			continue
+		}
+		for _, field := range s.ParamFields() {
+			owners["With"+field.Name] = s.Name
+		}
+	}
+	for _, s := range structs {
+		if s.Style != StyleOptions {
+			continue
+		}
+		for _, field := range s.ParamFields() {
+			name := "With" + field.Name
+			if other, ok := owners[name]; ok {
+				return fmt.Errorf("struct %s: option %s is also generated for struct %s", s.Name, name, other)
+			}
+			if resolver.declared[name] {
+				return fmt.Errorf("struct %s: option %s is already declared in the package", s.Name, name)
+			}
+			owners[name] = s.Name
+		}
+	}
+	return nil
+}
+
+// checkPatternNames checks that the variables holding the regular expressions
+// of the structs are unique and don't clash with declarations of the package,
+// including the variables generated for the other structs of the package
+func checkPatternNames(structs, others []StructInfo, resolver *kindResolver) error {
+	owners := make(map[string]string)
+	for _, s := range others {
+		for _, pattern := range s.Patterns {
+			owners[pattern.Var] = s.Name
+		}
+	}
+	for _, s := range structs {
+		for _, pattern := range s.Patterns {
+			if other, ok := owners[pattern.Var]; ok {
+				return fmt.Errorf("struct %s: pattern variable %s is also generated for struct %s", s.Name, pattern.Var, other)
+			}
+			if resolver.declared[pattern.Var] {
+				return fmt.Errorf("struct %s: pattern variable %s is already declared in the package", s.Name, pattern.Var)
+			}
+			owners[pattern.Var] = s.Name
+		}
+	}
+	return nil
+}
+
+// templateData collects the data for the code template from the given imports and structs
+func (g *Generator) templateData(imports []Import, structs []StructInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"PackageName": g.PackageName,
+		"Imports":     imports,
+		"Structs":     structs,
+	}
+}
+
+// generateCode generates the validation code from the given template data
+func (g *Generator) generateCode(data map[string]interface{}) (string, error) {
 	funcMap := template.FuncMap{
 		"split":      strings.Split,
 		"splitN":     strings.SplitN,
@@ -264,7 +863,6 @@ func (g *Generator) generateCode(structs []StructInfo) (string, error) {
 		"subtract": func(a, b int) int {
 			return a - b
 		},
-		"extractTypeParamNames": extractTypeParamNames,
 	}
 
 	tmpl, err := template.New("validation").Funcs(funcMap).Parse(codeTemplate)
@@ -273,10 +871,7 @@ func (g *Generator) generateCode(structs []StructInfo) (string, error) {
 	}
 
 	var buf bytes.Buffer
-	err = tmpl.Execute(&buf, map[string]interface{}{
-		"PackageName": g.PackageName,
-		"Structs":     structs,
-	})
+	err = tmpl.Execute(&buf, data)
 	if err != nil {
 		return "", fmt.Errorf("executing template: %w", err)
 	}
@@ -284,69 +879,260 @@ func (g *Generator) generateCode(structs []StructInfo) (string, error) {
 	return buf.String(), nil
 }
 
-// extractTypeParamNames extracts just the type parameter names from a full type parameter string
-func extractTypeParamNames(typeParams string) string {
-	// Remove the outer brackets
-	inner := strings.TrimPrefix(typeParams, "[")
-	inner = strings.TrimSuffix(inner, "]")
-
-	// Split by comma to get each parameter
-	params := strings.Split(inner, ", ")
-
-	var paramNames []string
-	for _, param := range params {
-		// Split by space and take the first part (the name)
-		parts := strings.Split(param, " ")
-		paramNames = append(paramNames, parts[0])
-	}
-
-	return "[" + strings.Join(paramNames, ", ") + "]"
-}
-
 // Code template for the generated validation code
-const codeTemplate = `// Code generated by validation-gen.
+const codeTemplate = `// Code generated by gen-isvalid. DO NOT EDIT.
+// Source hash: {{.Hash}}
 
 package {{.PackageName}}
 
 import (
-	"errors"
+{{- range .Imports}}{{if .IsStd}}
+	{{template "import" .}}
+{{- end}}{{end}}
+{{range .Imports}}{{if not .IsStd}}
+	{{template "import" .}}
+{{- end}}{{end}}
 )
 
 {{range .Structs}}
 // {{.Name}}Params is the parameter struct for creating a {{.Name}}
 type {{.Name}}Params{{if .IsGeneric}}{{.TypeParams}}{{end}} struct {
-{{- range .Fields}}
-	{{.Name}} {{if .IsPointer}}*{{end}}{{.Type}}
+{{- range .ParamFields}}
+	{{.Name}} {{.Type}}
 {{- end}}
 }
 
-// New{{.Name}} creates a new {{.Name}}
-func New{{.Name}}{{if .IsGeneric}}{{.TypeParams}}{{end}}(params {{.Name}}Params{{if .IsGeneric}}{{extractTypeParamNames .TypeParams}}{{end}}) (*{{.Name}}{{if .IsGeneric}}{{extractTypeParamNames .TypeParams}}{{end}}, error) {
-	if err := isValid{{.Name}}Params{{if .IsGeneric}}{{extractTypeParamNames .TypeParams}}{{end}}(params); err != nil {
-		return nil, err
+
+// Validate validates the {{.Name}}Params, returning the errors of the invalid fields joined
+{{- if .DefaultFields}}
+// The defaults are applied to a copy first, as the constructor does
+{{- end}}
+func (params {{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}) Validate() error {
+{{- if .DefaultFields}}
+	set{{.Name}}ParamsDefaults{{if .IsGeneric}}{{.TypeArgs}}{{end}}(&params)
+{{- end}}
+	return isValid{{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}(params)
+}
+{{- if .ValidateStruct}}
+
+// Validate validates the fields of the {{.Name}} like its constructor does
+func (s *{{.Name}}{{if .IsGeneric}}{{.TypeArgs}}{{end}}) Validate() error {
+	var params {{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}
+{{- range .FieldSources}}
+{{- if .Guard}}
+	if {{.Guard}} {
+		params.{{.Name}} = {{.Expr}}
+	}
+{{- else}}
+	params.{{.Name}} = {{.Expr}}
+{{- end}}
+{{- end}}
+	return isValid{{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}(params)
+}
+{{- end}}
+{{- if eq .Style "options"}}
+{{$s := .}}
+// {{.Name}}Option sets a field of the {{.Name}}Params
+type {{.Name}}Option{{if .IsGeneric}}{{.TypeParams}}{{end}} func(*{{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}})
+{{range .ParamFields}}
+// With{{.Name}} sets the {{.Name}} of a {{$s.Name}}
+func With{{.Name}}{{if $s.IsGeneric}}{{$s.TypeParams}}{{end}}(value {{.Type}}) {{$s.Name}}Option{{if $s.IsGeneric}}{{$s.TypeArgs}}{{end}} {
+	return func(params *{{$s.Name}}Params{{if $s.IsGeneric}}{{$s.TypeArgs}}{{end}}) {
+		params.{{.Name}} = value
 	}
+}
+{{end}}
+// New{{.Name}} creates a new {{.Name}} from the given options
+func New{{.Name}}{{if .IsGeneric}}{{.TypeParams}}{{end}}(opts ...{{.Name}}Option{{if .IsGeneric}}{{.TypeArgs}}{{end}}) (*{{.Name}}{{if .IsGeneric}}{{.TypeArgs}}{{end}}, error) {
+	var params {{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}
+	for _, opt := range opts {
+		opt(&params)
+	}
+{{template "construct" .}}
+}
+{{- else}}
 
-	return &{{.Name}}{{if .IsGeneric}}{{extractTypeParamNames .TypeParams}}{{end}}{
-{{- range .Fields}}
-		{{.Name}}: params.{{.Name}},
+// New{{.Name}} creates a new {{.Name}}
+func New{{.Name}}{{if .IsGeneric}}{{.TypeParams}}{{end}}(params {{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}) (*{{.Name}}{{if .IsGeneric}}{{.TypeArgs}}{{end}}, error) {
+{{- template "construct" .}}
+}
 {{- end}}
-	}, nil
+
+{{- if .Patterns}}
+var (
+{{- range .Patterns}}
+	{{.Var}} = regexp.MustCompile({{printf "%q" .Expr}})
+{{- end}}
+)
+{{end}}
+
+{{- if .Builder}}
+{{$s := .}}
+// {{.Name}}Builder builds a {{.Name}} one field at a time
+type {{.Name}}Builder{{if .IsGeneric}}{{.TypeParams}}{{end}} struct {
+	params {{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}
 }
 
+// New{{.Name}}Builder creates a new {{.Name}}Builder
+func New{{.Name}}Builder{{if .IsGeneric}}{{.TypeParams}}{{end}}() *{{.Name}}Builder{{if .IsGeneric}}{{.TypeArgs}}{{end}} {
+	return &{{.Name}}Builder{{if .IsGeneric}}{{.TypeArgs}}{{end}}{}
+}
+{{range .ParamFields}}
+// Set{{.Name}} sets the {{.Name}} of the {{$s.Name}}
+func (b *{{$s.Name}}Builder{{if $s.IsGeneric}}{{$s.TypeArgs}}{{end}}) Set{{.Name}}(value {{.Type}}) *{{$s.Name}}Builder{{if $s.IsGeneric}}{{$s.TypeArgs}}{{end}} {
+	b.params.{{.Name}} = value
+	return b
+}
+{{end}}
+// Build validates the fields and creates the {{.Name}}
+func (b *{{.Name}}Builder{{if .IsGeneric}}{{.TypeArgs}}{{end}}) Build() (*{{.Name}}{{if .IsGeneric}}{{.TypeArgs}}{{end}}, error) {
+	params := b.params
+{{template "construct" .}}
+}
+{{end}}
+{{- if .DefaultFields}}
+// set{{.Name}}ParamsDefaults sets the fields of the {{.Name}}Params that aren't set to their defaults
+func set{{.Name}}ParamsDefaults{{if .IsGeneric}}{{.TypeParams}}{{end}}(params *{{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}) {
+{{- range .DefaultFields}}
+	if {{.Default.Cond}} {
+		params.{{.Name}} = {{.Default.Value}}
+	}
+{{- end}}
+}
+{{end}}
 // isValid{{.Name}}Params validates the {{.Name}}Params
-func isValid{{.Name}}Params{{if .IsGeneric}}{{.TypeParams}}{{end}}(params {{.Name}}Params{{if .IsGeneric}}{{extractTypeParamNames .TypeParams}}{{end}}) error {
+func isValid{{.Name}}Params{{if .IsGeneric}}{{.TypeParams}}{{end}}(params {{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}) error {
 	var errs []error
-{{- range .Fields}}
-{{- if .IsPointer}}
-	if params.{{.Name}} == nil {
-		errs = append(errs, errors.New("{{.Name}} is required"))
+{{- $s := .}}
+{{- range $f := .ParamFields}}
+{{- range .Checks}}
+	if {{.Cond}} {
+		errs = append(errs, &isvalid.FieldError{
+			Struct: {{printf "%q" $s.Name}},
+			Field:  {{printf "%q" $f.Name}},
+			Rule:   {{printf "%q" .Rule}},
+{{- if .Param}}
+			Param:  {{printf "%q" .Param}},
+{{- end}}
+			Value:  params.{{$f.Name}},
+		})
+	}
+{{- end}}
+{{- if .Nested}}
+{{- if .Kind.Nilable}}
+	if params.{{.Name}} != nil {
+		if err := params.{{.Name}}.Validate(); err != nil {
+			errs = append(errs, isvalid.WithPath({{printf "%q" .Name}}, err))
+		}
+	}
+{{- else}}
+	if err := params.{{.Name}}.Validate(); err != nil {
+		errs = append(errs, isvalid.WithPath({{printf "%q" .Name}}, err))
+	}
+{{- end}}
+{{- end}}
+{{- with .Dive}}
+{{- if or .UsesElem .KeyChecks}}
+	for {{.Index}}{{if .UsesElem}}, elem{{end}} := range params.{{$f.Name}} {
+{{- range .KeyChecks}}
+		if {{.Cond}} {
+			errs = append(errs, &isvalid.FieldError{
+				Struct: {{printf "%q" $s.Name}},
+				Field:  {{$f.Dive.Path}},
+				Rule:   {{printf "%q" .Rule}},
+{{- if .Param}}
+				Param:  {{printf "%q" .Param}},
+{{- end}}
+				Value:  key,
+			})
+		}
+{{- end}}
+{{- range .Checks}}
+		if {{.Cond}} {
+			errs = append(errs, &isvalid.FieldError{
+				Struct: {{printf "%q" $s.Name}},
+				Field:  {{$f.Dive.Path}},
+				Rule:   {{printf "%q" .Rule}},
+{{- if .Param}}
+				Param:  {{printf "%q" .Param}},
+{{- end}}
+				Value:  elem,
+			})
+		}
+{{- end}}
+{{- if .Nested}}
+{{- if .Nilable}}
+		if elem != nil {
+			if err := elem.Validate(); err != nil {
+				errs = append(errs, isvalid.WithPath({{.Path}}, err))
+			}
+		}
+{{- else}}
+		if err := elem.Validate(); err != nil {
+			errs = append(errs, isvalid.WithPath({{.Path}}, err))
+		}
+{{- end}}
+{{- end}}
 	}
 {{- end}}
+{{- end}}
+{{- end}}
+{{- if .ParamsHook}}
+	if err := validate{{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}(params); err != nil {
+		errs = append(errs, err)
+	}
 {{- end}}
 	return errors.Join(errs...)
 }
 {{end}}
 
+{{define "import"}}{{if .Name}}{{.Name}} {{end}}{{printf "%q" .Path}}{{end}}
+
+{{define "construct"}}
+{{- if .DefaultFields}}
+	set{{.Name}}ParamsDefaults{{if .IsGeneric}}{{.TypeArgs}}{{end}}(&params)
+{{end}}
+	if err := isValid{{.Name}}Params{{if .IsGeneric}}{{.TypeArgs}}{{end}}(params); err != nil {
+		return nil, err
+	}
+
+{{- if or .ValidateMethod .InitHook}}
+
+	s := &{{.Name}}{{if .IsGeneric}}{{.TypeArgs}}{{end}}{
+{{- template "assign" .Fields}}
+	}
+{{- if .ValidateMethod}}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+{{- end}}
+{{- if .InitHook}}
+	if err := s.initialize(); err != nil {
+		return nil, err
+	}
+{{- end}}
+
+	return s, nil
+{{- else}}
+
+	return &{{.Name}}{{if .IsGeneric}}{{.TypeArgs}}{{end}}{
+{{- template "assign" .Fields}}
+	}, nil
+{{- end}}
+{{- end}}
+
+{{define "assign"}}
+{{- range .}}
+{{- if .Flatten}}
+		{{.FieldName}}: {{.Literal}}{
+{{- template "assign" .Flattened}}
+		},
+{{- else}}
+		{{.FieldName}}: params.{{.Name}},
+{{- end}}
+{{- end}}
+{{- end}}
+
 {{define "split"}}{{$s := index . 0}}{{$sep := index . 1}}{{$limit := index . 2}}{{if eq $limit "0"}}{{$s | split $sep}}{{else}}{{$s | splitN $sep $limit}}{{end}}{{end}}
 
 {{define "trimSuffix"}}{{$s := index . 0}}{{$suffix := index . 1}}{{$s | trimSuffix $suffix}}{{end}}
@@ -1,7 +1,11 @@
 package validation
 
 import (
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -16,7 +20,7 @@ func TestGenerator(t *testing.T) {
 	content := `package test
 
 // TestService is a test service
-//go:generate go run ../cmd/gen/main.go
+//go:generate go run github.com/strijmetkii/gen-isvalid/cmd/gen
 type TestService struct {
 	Client *Client
 	Config *Config
@@ -95,7 +99,7 @@ func TestNoStructs(t *testing.T) {
 	dir := t.TempDir()
 	testFile := filepath.Join(dir, "test.go")
 
-	// Create test content with no structs that have go:generate directives
+	// Create test content with no marked structs
 	content := `package test
 
 // TestService is a test service
@@ -123,10 +127,10 @@ type Config struct {}
 	// Generate code should fail
 	err = generator.Generate()
 	if err == nil {
-		t.Fatalf("Expected error when no structs with go:generate directive found")
+		t.Fatalf("Expected error when no marked structs found")
 	}
 
-	if !strings.Contains(err.Error(), "no structs with go:generate directive found") {
+	if !strings.Contains(err.Error(), "no structs marked with isvalid:gen found") {
 		t.Errorf("Unexpected error message: %v", err)
 	}
 }
@@ -140,7 +144,7 @@ func TestGenerics(t *testing.T) {
 	content := `package test
 
 // GenericService is a generic service
-//go:generate go run ../cmd/gen/main.go
+//isvalid:gen
 type GenericService[T any] struct {
 	Repository *Repository[T]
 	Logger *Logger
@@ -156,7 +160,7 @@ type Repository[T any] interface {
 type Logger struct {}
 
 // MultiParamService has multiple type parameters
-//go:generate go run ../cmd/gen/main.go
+//isvalid:gen
 type MultiParamService[K comparable, V any] struct {
 	Store *Store[K, V]
 	Config *Config
@@ -235,7 +239,7 @@ func TestForceFlag(t *testing.T) {
 	content := `package test
 
 // TestService is a test service
-//go:generate go run ../cmd/gen/main.go
+//isvalid:gen
 type TestService struct {
 	Client *Client
 }
@@ -265,11 +269,115 @@ type Client struct {}
 		t.Fatalf("Failed to read generated code: %v", err)
 	}
 
-	// Modify the source file
+	// Edit the generated file by hand
+	editedGen := string(firstGen) + "\n// edited by hand\n"
+	err = os.WriteFile(generator.OutputFile, []byte(editedGen), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to edit generated code: %v", err)
+	}
+
+	// Try to generate again without Force flag
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed on second generation: %v", err)
+	}
+
+	// Read the file again, it should be unchanged since the source is unchanged
+	secondGen, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code after second run: %v", err)
+	}
+
+	// Content should be the same as before
+	if string(secondGen) != editedGen {
+		t.Errorf("Generated file was modified when Force was false and the source was unchanged")
+	}
+
+	// Now set Force flag and generate again
+	generator.Force = true
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed on third generation with Force flag: %v", err)
+	}
+
+	// Read the file again, it should be regenerated
+	thirdGen, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code after third run: %v", err)
+	}
+
+	// Content should be the original output again
+	if string(firstGen) != string(thirdGen) {
+		t.Errorf("Generated file was not regenerated when Force was true")
+	}
+}
+
+func TestStaleness(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_stale.go")
+
+	// Create test content
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Client *Client
+}
+
+// Client is a test client
+type Client struct {}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code first time
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read the generated file
+	firstGen, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	// Check that the header records the source hash
+	firstHash := readHash(generator.OutputFile)
+	if len(firstHash) != 64 {
+		t.Fatalf("Generated code doesn't record the source hash: %q", firstHash)
+	}
+
+	// Changes outside of the struct definitions keep the hash
+	err = os.WriteFile(testFile, []byte(content+"\n// Unrelated comment\nfunc unrelated() {}\n"), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write modified test file: %v", err)
+	}
+
+	generator.Force = true
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to regenerate code: %v", err)
+	}
+	if readHash(generator.OutputFile) != firstHash {
+		t.Errorf("Source hash changed although the struct definitions didn't")
+	}
+	generator.Force = false
+
+	// Modify the struct definition
 	modifiedContent := `package test
 
 // TestService is a test service with modified fields
-//go:generate go run ../cmd/gen/main.go
+//isvalid:gen
 type TestService struct {
 	Client *Client
 	Logger *Logger
@@ -287,43 +395,2353 @@ type Logger struct {}
 		t.Fatalf("Failed to write modified test file: %v", err)
 	}
 
-	// Try to generate again without Force flag
+	// Generate again without Force flag
 	err = generator.Generate()
 	if err != nil {
 		t.Fatalf("Failed on second generation: %v", err)
 	}
 
-	// Read the file again, it should be unchanged
+	// Read the file again, it should be regenerated
 	secondGen, err := os.ReadFile(generator.OutputFile)
 	if err != nil {
 		t.Fatalf("Failed to read generated code after second run: %v", err)
 	}
 
-	// Content should be the same as before
-	if string(firstGen) != string(secondGen) {
-		t.Errorf("Generated file was modified when Force was false")
+	if string(firstGen) == string(secondGen) {
+		t.Errorf("Stale generated file was not regenerated")
 	}
 
-	// Now set Force flag and generate again
+	if readHash(generator.OutputFile) == firstHash {
+		t.Errorf("Source hash didn't change with the struct definitions")
+	}
+
+	// Check that the new field is in the generated code
+	if !strings.Contains(string(secondGen), "Logger *Logger") {
+		t.Errorf("Generated code doesn't contain the new field")
+	}
+}
+
+func TestNilableKinds(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_kinds.go")
+
+	// Create test content with every nilable kind
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen
+type TestService[T any] struct {
+	Client   *Client
+	Logger   Logger
+	Err      error
+	Handlers map[string]Handler
+	Tags     []string
+	OnClose  func() error
+	Events   chan int
+	Store    Store[T]
+	Item     T
+	Name     string
+	Counts   [4]int
+}
+
+// Client is a test client
+type Client struct {}
+
+// Logger is a test logger
+type Logger interface {
+	Info(msg string)
+}
+
+// Handler is a named function type
+type Handler func(string) error
+
+// Store is a generic store
+type Store[T any] interface {
+	Get(id string) (T, error)
+}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that every nilable field is validated
+	for _, name := range []string{"Client", "Logger", "Err", "Handlers", "Tags", "OnClose", "Events", "Store"} {
+		if !strings.Contains(codeStr, "if params."+name+" == nil {") {
+			t.Errorf("Generated code doesn't validate nilable field %s", name)
+		}
+	}
+
+	// Check that non-nilable fields are not validated
+	for _, name := range []string{"Item", "Name", "Counts"} {
+		if strings.Contains(codeStr, "if params."+name+" == nil {") {
+			t.Errorf("Generated code validates non-nilable field %s", name)
+		}
+	}
+}
+
+func TestTypeCheck(t *testing.T) {
+	// Create a temporary package with two files
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_typecheck.go")
+	otherFile := filepath.Join(dir, "types.go")
+
+	// Create test content whose field types are declared elsewhere
+	content := `package test
+
+import (
+	"io"
+	"time"
+)
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Writer  io.Writer
+	Logger  Logger
+	Handler Handler
+	Timeout time.Duration
+}
+`
+
+	otherContent := `package test
+
+// Logger is a test logger
+type Logger interface {
+	Info(msg string)
+}
+
+// Handler is a named function type
+type Handler func() error
+`
+
+	// Write test content to files
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(otherFile, []byte(otherContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Generate without type information first
+	generator := NewGenerator(testFile)
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	// Types declared in the other files of the package are classified from
+	// their declarations
+	for _, name := range []string{"Logger", "Handler"} {
+		if !strings.Contains(string(generatedCode), "if params."+name+" == nil {") {
+			t.Errorf("Generated code doesn't validate field %s declared in another file", name)
+		}
+	}
+
+	// Types of other packages can't be classified from syntax alone
+	if strings.Contains(string(generatedCode), "if params.Writer == nil {") {
+		t.Errorf("Generated code validates a field of unknown kind")
+	}
+
+	// Generate again with type information
 	generator.Force = true
+	generator.TypeCheck = true
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Failed to generate code with type checking: %v", err)
+	}
+
+	generatedCode, err = os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that resolved nilable fields are validated
+	for _, name := range []string{"Writer", "Logger", "Handler"} {
+		if !strings.Contains(codeStr, "if params."+name+" == nil {") {
+			t.Errorf("Generated code doesn't validate type-checked field %s", name)
+		}
+	}
+
+	// Check that resolved value fields are not validated
+	if strings.Contains(codeStr, "if params.Timeout == nil {") {
+		t.Errorf("Generated code validates non-nilable field Timeout")
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_tags.go")
+
+	// Create test content with validation rules
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Name    string   ` + "`validate:\"required,min_len=3,max_len=32\"`" + `
+	Retries int      ` + "`validate:\"min=1,max=10\"`" + `
+	Mode    string   ` + "`validate:\"oneof=fast slow\"`" + `
+	Level   int      ` + "`validate:\"oneof=1 2 3\"`" + `
+	Code    string   ` + "`validate:\"len=4\"`" + `
+	Region  string   ` + "`validate:\"optional,regexp=^[a-z]{2}-[a-z]+$\"`" + `
+	Tags    []string ` + "`validate:\"optional,max_len=5\"`" + `
+	Client  *Client
+}
+
+// Client is a test client
+type Client struct {}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
 	err = generator.Generate()
 	if err != nil {
-		t.Fatalf("Failed on third generation with Force flag: %v", err)
+		t.Fatalf("Failed to generate code: %v", err)
 	}
 
-	// Read the file again, it should be changed
-	thirdGen, err := os.ReadFile(generator.OutputFile)
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
 	if err != nil {
-		t.Fatalf("Failed to read generated code after third run: %v", err)
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that every rule produces its check
+	checks := []string{
+		`if params.Name == "" {`,
+		`if len(params.Name) < 3 {`,
+		`if len(params.Name) > 32 {`,
+		`if params.Retries < 1 {`,
+		`if params.Retries > 10 {`,
+		`if params.Mode != "fast" && params.Mode != "slow" {`,
+		`if params.Level != 1 && params.Level != 2 && params.Level != 3 {`,
+		`if len(params.Code) != 4 {`,
+		`testService_RegionPattern = regexp.MustCompile("^[a-z]{2}-[a-z]+$")`,
+		`if params.Region != "" && !testService_RegionPattern.MatchString(params.Region) {`,
+		`if params.Tags != nil && len(params.Tags) > 5 {`,
+		`if params.Client == nil {`,
+		"Field:  \"Retries\",\n\t\t\tRule:   \"min\",\n\t\t\tParam:  \"1\",\n\t\t\tValue:  params.Retries,",
+	}
+	for _, check := range checks {
+		if !strings.Contains(codeStr, check) {
+			t.Errorf("Generated code doesn't contain %s", check)
+		}
 	}
 
-	// Content should be different now
-	if string(firstGen) == string(thirdGen) {
-		t.Errorf("Generated file was not modified when Force was true")
+	// Optional nilable fields are not required
+	if strings.Contains(codeStr, "if params.Tags == nil {") {
+		t.Errorf("Generated code requires optional field Tags")
 	}
 
-	// Check that the new field is in the generated code
-	if !strings.Contains(string(thirdGen), "Logger *Logger") {
-		t.Errorf("Generated code doesn't contain the new field")
+	// Check that invalid rules are reported
+	invalid := `package test
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Name string ` + "`validate:\"min=3\"`" + `
+}
+`
+	if err := os.WriteFile(testFile, []byte(invalid), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	generator.Force = true
+	err = generator.Generate()
+	if err == nil {
+		t.Fatalf("Expected error for rule that doesn't apply to the field type")
+	}
+
+	if !strings.Contains(err.Error(), "field TestService.Name: rule min applies to numbers, not string") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+
+	// Limits must be representable by the type of the field
+	for _, tc := range []struct {
+		field string
+		err   string
+	}{
+		{"Count int `validate:\"min=1.5\"`", "field TestService.Count: rule min requires an integer for int, got \"1.5\""},
+		{"Count Count `validate:\"max=2.5\"`", "field TestService.Count: rule max requires an integer for Count, got \"2.5\""},
+		{"Size uint `validate:\"min=-1\"`", "field TestService.Size: rule min requires a non-negative number for uint, got \"-1\""},
+		{"Sizes []uint8 `validate:\"dive,max=-2\"`", "dive: rule max requires a non-negative number for uint8, got \"-2\""},
+	} {
+		invalid := "package test\n\n//isvalid:gen\ntype TestService struct {\n\t" + tc.field + "\n}\n\n// Count is a named integer\ntype Count int64\n"
+		if err := os.WriteFile(testFile, []byte(invalid), 0o644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		for _, typeCheck := range []bool{false, true} {
+			generator.TypeCheck = typeCheck
+			err := generator.Generate()
+			if err == nil || !strings.Contains(err.Error(), tc.err) || !strings.Contains(err.Error(), "test_tags.go:") {
+				t.Errorf("Generate() with %s and type checking %v: expected a positioned error %q, got %v", tc.field, typeCheck, tc.err, err)
+			}
+		}
+	}
+	generator.TypeCheck = false
+
+	// Integral limits are fine for integers, and any number for floats
+	valid := "package test\n\n//isvalid:gen\ntype TestService struct {\n\tCount int `validate:\"min=1.0,max=1e3\"`\n\tRatio float64 `validate:\"min=-0.5\"`\n}\n"
+	if err := os.WriteFile(testFile, []byte(valid), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := generator.Generate(); err != nil {
+		t.Errorf("Failed to generate code with valid limits: %v", err)
 	}
 }
+
+func TestOptionalMarker(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_optional.go")
+
+	// Create test content with optional pointer fields
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Client  *Client
+	MaxSize *int //isvalid:optional
+	//isvalid:optional
+	Limit   *int
+	Backup  *Client ` + "`validate:\"optional\"`" + `
+}
+
+// Client is a test client
+type Client struct {}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that required pointers are still validated
+	if !strings.Contains(codeStr, "if params.Client == nil {") {
+		t.Errorf("Generated code doesn't validate required field Client")
+	}
+
+	// Check that optional pointers are kept but not validated
+	for _, name := range []string{"MaxSize", "Limit", "Backup"} {
+		if !strings.Contains(codeStr, "params."+name+",") {
+			t.Errorf("Generated constructor doesn't assign optional field %s", name)
+		}
+		if strings.Contains(codeStr, "if params."+name+" == nil {") {
+			t.Errorf("Generated code requires optional field %s", name)
+		}
+	}
+}
+
+func TestPackageMode(t *testing.T) {
+	// Create a temporary package with several files
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"client.go": `package test
+
+//go:generate go run github.com/strijmetkii/gen-isvalid/cmd/gen -dir .
+
+// ClientService is a test service
+//isvalid:gen
+type ClientService struct {
+	Client *Client
+}
+
+// Client is a test client
+type Client struct {}
+`,
+		"logger.go": `package test
+
+// LoggerService is a test service
+//isvalid:gen
+type LoggerService struct {
+	Logger Logger
+}
+`,
+		"types.go": `package test
+
+// Logger is declared in another file than the struct using it
+type Logger interface {
+	Info(msg string)
+}
+`,
+		"client_test.go": `package test
+
+// TestOnlyService must not be generated
+//isvalid:gen
+type TestOnlyService struct {
+	Client *Client
+}
+`,
+		"old_gen.go": `// Code generated by gen-isvalid. DO NOT EDIT.
+
+package test
+
+// GeneratedService must not be generated
+//isvalid:gen
+type GeneratedService struct {
+	Client *Client
+}
+`,
+	}
+
+	// Write test content to files
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	// Create package generator
+	generator := NewPackageGenerator(dir)
+
+	if generator.OutputFile != filepath.Join(dir, "isvalid_gen.go") {
+		t.Errorf("Unexpected output file: %s", generator.OutputFile)
+	}
+
+	// Generate code
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that the structs of every file are generated
+	for _, name := range []string{"ClientService", "LoggerService"} {
+		if !strings.Contains(codeStr, "func New"+name+"(") {
+			t.Errorf("Generated code doesn't have constructor for %s", name)
+		}
+	}
+
+	// Types declared in other files of the package are resolved
+	if !strings.Contains(codeStr, "if params.Logger == nil {") {
+		t.Errorf("Generated code doesn't validate interface declared in another file")
+	}
+
+	// Check that tests and generated files are skipped
+	for _, name := range []string{"TestOnlyService", "GeneratedService"} {
+		if strings.Contains(codeStr, name) {
+			t.Errorf("Generated code contains %s", name)
+		}
+	}
+
+	// Regenerating must skip the output file itself
+	generator.Force = true
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Failed to regenerate code: %v", err)
+	}
+}
+
+func TestGenerateMarker(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_marker.go")
+
+	// Create test content with a single go:generate for several marked structs
+	content := `package test
+
+//go:generate go run github.com/strijmetkii/gen-isvalid/cmd/gen
+
+// FirstService is marked for generation
+//
+//isvalid:gen
+type FirstService struct {
+	Client *Client
+}
+
+type (
+	// SecondService is marked inside a type group
+	//isvalid:gen
+	SecondService struct {
+		Client *Client
+	}
+
+	// Unmarked is not generated
+	Unmarked struct {
+		Client *Client
+	}
+)
+
+// Kind has an unrelated directive
+//go:generate stringer -type=Kind
+type Kind struct {
+	Client *Client
+}
+
+// Mocked has an unrelated directive
+//go:generate mockgen -source=test_marker.go
+type Mocked struct {
+	Client *Client
+}
+
+// Client is a test client
+type Client struct {}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that marked structs are generated
+	for _, name := range []string{"FirstService", "SecondService"} {
+		if !strings.Contains(codeStr, "func New"+name+"(") {
+			t.Errorf("Generated code doesn't have constructor for marked struct %s", name)
+		}
+	}
+
+	// Check that structs with unrelated directives are ignored
+	for _, name := range []string{"Unmarked", "Kind", "Mocked"} {
+		if strings.Contains(codeStr, "func New"+name+"(") {
+			t.Errorf("Generated code has constructor for unmarked struct %s", name)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_check.go")
+
+	// Create test content
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Client *Client
+}
+
+// Client is a test client
+type Client struct {}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// A missing output file is out of date
+	diff, err := generator.Check()
+	if err != nil {
+		t.Fatalf("Failed to check code: %v", err)
+	}
+	if !strings.Contains(diff, "+func NewTestService(params TestServiceParams)") {
+		t.Errorf("Check doesn't report the missing output file: %s", diff)
+	}
+	if _, err := os.Stat(generator.OutputFile); !os.IsNotExist(err) {
+		t.Fatalf("Check wrote the output file")
+	}
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Freshly generated code is up to date
+	diff, err = generator.Check()
+	if err != nil {
+		t.Fatalf("Failed to check code: %v", err)
+	}
+	if diff != "" {
+		t.Errorf("Check reports differences for up to date output: %s", diff)
+	}
+
+	// Modify the struct definition without regenerating
+	modifiedContent := strings.Replace(content, "Client *Client\n}", "Client *Client\n\tBackup *Client\n}", 1)
+	err = os.WriteFile(testFile, []byte(modifiedContent), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write modified test file: %v", err)
+	}
+
+	before, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	diff, err = generator.Check()
+	if err != nil {
+		t.Fatalf("Failed to check code: %v", err)
+	}
+
+	// Check that the diff shows the stale output
+	for _, line := range []string{"--- " + generator.OutputFile, "+++ " + generator.OutputFile + " (generated)", "+\tif params.Backup == nil {"} {
+		if !strings.Contains(diff, line) {
+			t.Errorf("Diff doesn't contain %q: %s", line, diff)
+		}
+	}
+
+	// Check that nothing was written
+	after, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("Check modified the output file")
+	}
+}
+
+func TestMultiNameFields(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_multi.go")
+
+	// Create test content with fields sharing a declaration
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Primary, Replica *DB
+	Min, Max         int ` + "`validate:\"min=1\"`" + `
+	Name, internal   string
+}
+
+// DB is a test database
+type DB struct {}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that every name gets its own field, assignment and validation
+	for _, name := range []string{"Primary", "Replica", "Min", "Max", "Name"} {
+		if !strings.Contains(codeStr, "\t"+name+" ") {
+			t.Errorf("Generated parameter struct doesn't contain field %s", name)
+		}
+		if !strings.Contains(codeStr, "params."+name+",") {
+			t.Errorf("Generated constructor doesn't assign field %s", name)
+		}
+	}
+
+	for _, check := range []string{
+		"if params.Primary == nil {",
+		"if params.Replica == nil {",
+		"if params.Min < 1 {",
+		"if params.Max < 1 {",
+	} {
+		if !strings.Contains(codeStr, check) {
+			t.Errorf("Generated code doesn't contain %s", check)
+		}
+	}
+
+	// Unexported names are still skipped
+	if strings.Contains(codeStr, "internal") {
+		t.Errorf("Generated code contains unexported field internal")
+	}
+}
+
+func TestEmbeddedFields(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_embedded.go")
+
+	// Create test content with embedded fields
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	*Base
+	Logger
+	Options ` + "`isvalid:\"flatten\"`" + `
+	*Limits ` + "`isvalid:\"flatten\"`" + `
+	Name string
+}
+
+// Base is embedded as a pointer
+type Base struct {}
+
+// Logger is an embedded interface
+type Logger interface {
+	Info(msg string)
+}
+
+// Options is flattened into the parameters
+type Options struct {
+	Region string ` + "`validate:\"required\"`" + `
+	Client *Client
+	secret string
+}
+
+// Limits is flattened through a pointer
+type Limits struct {
+	MaxSize int ` + "`validate:\"min=1\"`" + `
+}
+
+// Client is a test client
+type Client struct {}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := strings.Join(strings.Fields(string(generatedCode)), " ")
+
+	// Check that embedded fields are named after their type
+	for _, field := range []string{
+		"Base *Base",
+		"Logger Logger",
+		"Region string",
+		"Client *Client",
+		"MaxSize int",
+	} {
+		if !strings.Contains(codeStr, field) {
+			t.Errorf("Generated parameter struct doesn't contain %s", field)
+		}
+	}
+
+	// Check that embedded and flattened fields are assigned
+	for _, assign := range []string{
+		"Base: params.Base,",
+		"Logger: params.Logger,",
+		"Options: Options{ Region: params.Region, Client: params.Client, },",
+		"Limits: &Limits{ MaxSize: params.MaxSize, },",
+	} {
+		if !strings.Contains(codeStr, assign) {
+			t.Errorf("Generated constructor doesn't contain %s", assign)
+		}
+	}
+
+	// Check that embedded and flattened fields are validated
+	for _, check := range []string{
+		"if params.Base == nil {",
+		"if params.Logger == nil {",
+		`if params.Region == "" {`,
+		"if params.Client == nil {",
+		"if params.MaxSize < 1 {",
+	} {
+		if !strings.Contains(codeStr, check) {
+			t.Errorf("Generated code doesn't contain %s", check)
+		}
+	}
+
+	// Unexported fields of flattened structs are skipped
+	if strings.Contains(codeStr, "secret") {
+		t.Errorf("Generated code contains unexported field of flattened struct")
+	}
+
+	// Structs declared in the other files of the package can be flattened,
+	// along with the imports of their field types
+	content = `package test
+
+//isvalid:gen
+type TestService struct {
+	Options ` + "`isvalid:\"flatten\"`" + `
+}
+`
+	otherContent := `package test
+
+import "time"
+
+// Options is declared in another file
+type Options struct {
+	Timeout time.Duration
+	Logger  Logger
+}
+
+// Logger is a test logger
+type Logger interface {
+	Info(msg string)
+}
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "options.go"), []byte(otherContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Failed to flatten a struct of another file: %v", err)
+	}
+	generatedCode, err = os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+	for _, want := range []string{"\"time\"", "Timeout time.Duration", "if params.Logger == nil {"} {
+		if !strings.Contains(string(generatedCode), want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_imports.go")
+
+	// Create test content with field types from other packages
+	content := `package test
+
+import (
+	"fmt"
+	"net/http"
+	str "strings"
+	"time"
+	. "net/url"
+)
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Client  *http.Client
+	Timeout time.Duration
+	Builder *str.Builder
+	BaseURL *URL
+	Handler func(w http.ResponseWriter) error
+}
+
+func (s *TestService) String() string {
+	return fmt.Sprint(s.Client)
+}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that the imports used by the field types are copied with their names
+	for _, imp := range []string{
+		`"errors"`,
+		`"github.com/strijmetkii/gen-isvalid/isvalid"`,
+		`"net/http"`,
+		`. "net/url"`,
+		`str "strings"`,
+		`"time"`,
+	} {
+		if !strings.Contains(codeStr, "\t"+imp+"\n") {
+			t.Errorf("Generated code doesn't import %s", imp)
+		}
+	}
+
+	// Check that unused imports are pruned
+	if strings.Contains(codeStr, `"fmt"`) {
+		t.Errorf("Generated code imports unused package fmt")
+	}
+
+	// A qualifier without a matching import is an error
+	content = `package test
+
+//isvalid:gen
+type TestService struct {
+	Client *http.Client
+}
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), "package http is not imported") {
+		t.Errorf("Expected an error for a missing import, got %v", err)
+	}
+
+	// Several dot imports can't be told apart without type checking, and
+	// only the one declaring the field types is kept with it
+	content = `package test
+
+import (
+	. "net/url"
+	. "unicode/utf8"
+)
+
+//isvalid:gen
+type TestService struct {
+	BaseURL *URL
+}
+
+var _ = RuneLen
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), "struct TestService: can't tell which of the dot imports net/url, unicode/utf8 declares URL without type checking, use -typecheck") {
+		t.Errorf("Expected an error for several dot imports, got %v", err)
+	}
+
+	generator.TypeCheck = true
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Failed to generate code with type checking: %v", err)
+	}
+	generatedCode, err = os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+	if !strings.Contains(string(generatedCode), `. "net/url"`) || strings.Contains(string(generatedCode), "unicode/utf8") {
+		t.Errorf("Generated code doesn't import only the dot import declaring URL:\n%s", generatedCode)
+	}
+}
+
+func TestUnsupportedFieldType(t *testing.T) {
+	// Create test content whose field type is replaced below, since the
+	// parser rejects most expressions that aren't types
+	content := `package test
+
+//isvalid:gen
+type TestService struct {
+	Name   string
+	Client *http.Client
+}
+`
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "test_unsupported.go", content, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Failed to parse test content: %v", err)
+	}
+
+	// Turn *http.Client into *newHTTP().Client
+	structType := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType)
+	selector := structType.Fields.List[1].Type.(*ast.StarExpr).X.(*ast.SelectorExpr)
+	selector.X = &ast.CallExpr{Fun: &ast.Ident{NamePos: selector.X.Pos(), Name: "newHTTP"}}
+
+	// Extracting must fail with the field and its position instead of panicking
+	generator := &Generator{PackageName: "test"}
+	_, err = generator.extractStructs(fset, file, newKindResolver([]*ast.File{file}))
+	if err == nil {
+		t.Fatalf("Expected an error for an unsupported field type")
+	}
+	for _, want := range []string{"test_unsupported.go:6:9", "field TestService.Client"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error %q doesn't contain %q", err, want)
+		}
+	}
+}
+
+func TestArrayLengths(t *testing.T) {
+	// Create a temporary package with two files
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_arrays.go")
+	otherFile := filepath.Join(dir, "consts.go")
+
+	// Create test content with array lengths that aren't literals
+	content := `package test
+
+import "math"
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Shards  [MaxShards]Shard
+	Buffer  [math.MaxInt8]byte
+	Windows [2 * MaxShards]int
+}
+
+// Shard is a test shard
+type Shard struct{}
+`
+
+	otherContent := `package test
+
+// MaxShards is declared in another file of the package
+const MaxShards = 4
+`
+
+	// Write test content to files
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(otherFile, []byte(otherContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator with type checking to verify the lengths
+	generator := NewGenerator(testFile)
+	generator.TypeCheck = true
+
+	// Generate code
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that the lengths are kept verbatim
+	for _, want := range []string{
+		"Shards  [MaxShards]Shard",
+		"Buffer  [math.MaxInt8]byte",
+		"Windows [2 * MaxShards]int",
+		"\t\"math\"\n",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// A length that isn't a constant is reported when type checking
+	otherContent = `package test
+
+// MaxShards is a variable, which can't be used as array length
+var MaxShards = 4
+`
+	if err := os.WriteFile(otherFile, []byte(otherContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), "array length MaxShards is not a constant") {
+		t.Errorf("Expected an error for a variable array length, got %v", err)
+	}
+}
+
+func TestOptionsStyle(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_options.go")
+
+	// Create test content with a struct selecting the options style
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen style=options
+type TestService struct {
+	Client *Client
+	Name   string ` + "`validate:\"required\"`" + `
+}
+
+// TestCache is a generic test service
+//isvalid:gen
+type TestCache[K comparable, V any] struct {
+	Store map[K]V
+}
+
+// Client is a test client
+type Client struct{}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check the option type, the options and the constructor
+	for _, want := range []string{
+		"type TestServiceOption func(*TestServiceParams)",
+		"func WithClient(value *Client) TestServiceOption {",
+		"func WithName(value string) TestServiceOption {",
+		"func NewTestService(opts ...TestServiceOption) (*TestService, error) {",
+		"if err := isValidTestServiceParams(params); err != nil {",
+		"func NewTestCache[K comparable, V any](params TestCacheParams[K, V]) (*TestCache[K, V], error) {",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// Select the options style for every struct
+	generator.Style = StyleOptions
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Failed to generate code with the options style: %v", err)
+	}
+
+	generatedCode, err = os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr = string(generatedCode)
+
+	for _, want := range []string{
+		"type TestCacheOption[K comparable, V any] func(*TestCacheParams[K, V])",
+		"func WithStore[K comparable, V any](value map[K]V) TestCacheOption[K, V] {",
+		"func NewTestCache[K comparable, V any](opts ...TestCacheOption[K, V]) (*TestCache[K, V], error) {",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// Options with the same name for different structs are an error
+	content = `package test
+
+//isvalid:gen style=options
+type TestService struct {
+	Name string
+}
+
+//isvalid:gen style=options
+type OtherService struct {
+	Name string
+}
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), "option WithName is also generated for struct TestService") {
+		t.Errorf("Expected an error for duplicate options, got %v", err)
+	}
+
+	// So are options generated for a struct of another file of the package
+	content = `package test
+
+//isvalid:gen style=options
+type TestService struct {
+	Name string
+}
+`
+	otherContent := `package test
+
+//isvalid:gen style=options
+type OtherService struct {
+	Name string
+}
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.go"), []byte(otherContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), "struct TestService: option WithName is also generated for struct OtherService") {
+		t.Errorf("Expected an error for options generated by another file, got %v", err)
+	}
+
+	// Unknown styles are an error
+	generator.Style = "builder"
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), `unknown constructor style "builder"`) {
+		t.Errorf("Expected an error for an unknown style, got %v", err)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_builder.go")
+
+	// Create test content with a generic struct asking for a builder
+	content := `package test
+
+// TestCache is a generic test service
+//isvalid:gen builder
+type TestCache[K comparable, V any] struct {
+	Store map[K]V
+	TTL   int ` + "`validate:\"min=1\"`" + `
+}
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Name string
+}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check the builder type, its setters and Build
+	for _, want := range []string{
+		"type TestCacheBuilder[K comparable, V any] struct {",
+		"func NewTestCacheBuilder[K comparable, V any]() *TestCacheBuilder[K, V] {",
+		"func (b *TestCacheBuilder[K, V]) SetStore(value map[K]V) *TestCacheBuilder[K, V] {",
+		"func (b *TestCacheBuilder[K, V]) SetTTL(value int) *TestCacheBuilder[K, V] {",
+		"func (b *TestCacheBuilder[K, V]) Build() (*TestCache[K, V], error) {",
+		"if err := isValidTestCacheParams[K, V](params); err != nil {",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// Structs without the marker argument don't get a builder
+	if strings.Contains(codeStr, "TestServiceBuilder") {
+		t.Errorf("Generated code contains a builder for TestService")
+	}
+
+	// The Builder option generates builders for every struct
+	generator.Builder = true
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Failed to generate code with builders: %v", err)
+	}
+
+	generatedCode, err = os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	if !strings.Contains(string(generatedCode), "func (b *TestServiceBuilder) SetName(value string) *TestServiceBuilder {") {
+		t.Errorf("Generated code doesn't contain a builder for TestService")
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_defaults.go")
+
+	// Create test content with defaults from both tags
+	content := `package test
+
+import "time"
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Name    string        ` + "`default:\"main\" validate:\"required\"`" + `
+	Timeout time.Duration ` + "`default:\"1m30s\"`" + `
+	Workers int           ` + "`isvalid:\"default=4\" validate:\"min=1\"`" + `
+	Client  *Client       ` + "`default:\"DefaultClient\"`" + `
+	Retries int
+}
+
+// Client is a test client
+type Client struct{}
+
+// DefaultClient is the default test client
+var DefaultClient = &Client{}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that the defaults are set before validating
+	for _, want := range []string{
+		"func setTestServiceParamsDefaults(params *TestServiceParams) {",
+		"params.Name = \"main\"",
+		"params.Timeout = 90 * time.Second",
+		"params.Workers = 4",
+		"params.Client = DefaultClient",
+		"setTestServiceParamsDefaults(&params)\n\n\tif err := isValidTestServiceParams(params); err != nil {",
+		// Validate accepts the same Params as the constructor, such as a zero
+		// Workers that defaults to 4
+		"func (params TestServiceParams) Validate() error {\n\tsetTestServiceParamsDefaults(&params)\n\treturn isValidTestServiceParams(params)\n}",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// Fields without defaults are left alone
+	if strings.Contains(codeStr, "params.Retries =") {
+		t.Errorf("Generated code sets a default for Retries")
+	}
+
+	// Defaults that aren't Go expressions are an error
+	content = `package test
+
+//isvalid:gen
+type TestService struct {
+	Workers int ` + "`default:\"4 workers\"`" + `
+}
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), `default "4 workers" is not a Go expression`) {
+		t.Errorf("Expected an error for an invalid default, got %v", err)
+	}
+}
+
+func TestValidateMethods(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_validate.go")
+
+	// Create test content with a struct asking for its own Validate method
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen validate
+type TestService struct {
+	Client *Client
+	*Base  ` + "`isvalid:\"flatten\"`" + `
+}
+
+// TestCache is a generic test service
+//isvalid:gen
+type TestCache[K comparable, V any] struct {
+	Store map[K]V
+}
+
+// Base is a flattened test struct
+type Base struct {
+	Name string ` + "`validate:\"required\"`" + `
+}
+
+// Client is a test client
+type Client struct{}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check the Validate methods of the Params structs and of the struct
+	for _, want := range []string{
+		"func (params TestServiceParams) Validate() error {\n\treturn isValidTestServiceParams(params)",
+		"func (params TestCacheParams[K, V]) Validate() error {\n\treturn isValidTestCacheParams[K, V](params)",
+		"func (s *TestService) Validate() error {",
+		"params.Client = s.Client",
+		"if s.Base != nil {\n\t\tparams.Name = s.Base.Name\n\t}",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// Structs without the marker argument don't get a Validate method
+	if strings.Contains(codeStr, "func (s *TestCache[K, V]) Validate() error {") {
+		t.Errorf("Generated code contains a Validate method for TestCache")
+	}
+
+	// A field named Validate would clash with the method of the Params struct
+	content = `package test
+
+//isvalid:gen
+type TestService struct {
+	Validate func() error
+}
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), "duplicate field or method in TestServiceParams") {
+		t.Errorf("Expected an error for a field named Validate, got %v", err)
+	}
+}
+
+func TestValidateHooks(t *testing.T) {
+	// Create a temporary package with two files
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_hooks.go")
+	otherFile := filepath.Join(dir, "hooks.go")
+
+	// Create test content with structs whose hooks are declared elsewhere
+	content := `package test
+
+// TestProcessor is a test processor
+//isvalid:gen
+type TestProcessor[E any] struct {
+	MaxWorkers int
+	BatchSize  int
+}
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Name string
+}
+`
+
+	otherContent := `package test
+
+import "errors"
+
+func validateTestProcessorParams[E any](params TestProcessorParams[E]) error {
+	if params.MaxWorkers > params.BatchSize*2 {
+		return errors.New("too many workers")
+	}
+	return nil
+}
+
+func (s *TestService) Validate() error {
+	return nil
+}
+`
+
+	// Write test content to files
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(otherFile, []byte(otherContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	if err := generator.Generate(); err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that the hooks are called
+	for _, want := range []string{
+		"if err := validateTestProcessorParams[E](params); err != nil {\n\t\terrs = append(errs, err)\n\t}",
+		"s := &TestService{",
+		"if err := isValidTestServiceParams(params); err != nil {\n\t\treturn nil, err\n\t}\n\n\ts := &TestService{",
+		"if err := s.Validate(); err != nil {\n\t\treturn nil, err\n\t}\n\n\treturn s, nil",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// Hooks with other signatures are an error
+	otherContent = `package test
+
+func validateTestServiceParams(params TestServiceParams) bool {
+	return true
+}
+`
+	if err := os.WriteFile(otherFile, []byte(otherContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), "validateTestServiceParams must be declared as func(TestServiceParams) error") {
+		t.Errorf("Expected an error for a hook with another signature, got %v", err)
+	}
+}
+
+func TestInitHook(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_init.go")
+
+	// Create test content with a struct that sets up derived state
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	MaxWorkers int
+	workers    chan struct{}
+}
+
+func (s *TestService) initialize() error {
+	s.workers = make(chan struct{}, s.MaxWorkers)
+	return nil
+}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that the hook is called once the struct is built
+	want := "s := &TestService{\n\t\tMaxWorkers: params.MaxWorkers,\n\t}\n\tif err := s.initialize(); err != nil {\n\t\treturn nil, err\n\t}\n\n\treturn s, nil"
+	if !strings.Contains(codeStr, want) {
+		t.Errorf("Generated code doesn't call the initialize hook")
+	}
+
+	// Unexported fields stay out of the Params struct
+	if strings.Contains(codeStr, "workers") {
+		t.Errorf("Generated code contains unexported field workers")
+	}
+
+	// Hooks with other signatures are an error
+	content = strings.Replace(content, "initialize() error {", "initialize() {", 1)
+	content = strings.Replace(content, "\treturn nil\n", "", 1)
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), "TestService.initialize must be declared as func() error") {
+		t.Errorf("Expected an error for a hook with another signature, got %v", err)
+	}
+}
+
+func TestUnexportedFields(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_unexported.go")
+
+	// Create test content with unexported fields opting into the Params struct
+	content := `package test
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	client *Client ` + "`isvalid:\"include\"`" + `
+	name   string  ` + "`isvalid:\"include\" validate:\"required\"`" + `
+	cache  map[string]string
+}
+
+// TestCache is a test service including all of its unexported fields
+//isvalid:gen unexported
+type TestCache struct {
+	store map[string]string
+	Name  string
+}
+
+// Client is a test client
+type Client struct{}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that included fields are exported in the Params struct and
+	// assigned back to the unexported fields
+	for _, want := range []string{
+		"\tClient *Client\n",
+		"\tName   string\n",
+		"client: params.Client,",
+		"name:   params.Name,",
+		"if params.Client == nil {",
+		"if params.Name == \"\" {",
+		"\tStore map[string]string\n",
+		"store: params.Store,",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// Fields without the option are still skipped
+	if strings.Contains(codeStr, "cache") {
+		t.Errorf("Generated code contains unexported field cache")
+	}
+
+	// An included field can't clash with an exported one
+	content = `package test
+
+//isvalid:gen
+type TestService struct {
+	client *Client ` + "`isvalid:\"include\"`" + `
+	Client *Client
+}
+
+// Client is a test client
+type Client struct{}
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err = generator.Generate()
+	if err == nil || !strings.Contains(err.Error(), "field TestService.Client: duplicate field or method in TestServiceParams") {
+		t.Errorf("Expected an error for clashing fields, got %v", err)
+	}
+}
+
+func TestNestedValidation(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_nested.go")
+
+	// Create test content with fields whose types have Validate methods
+	content := `package test
+
+import "net/url"
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	Options Options
+	Limits  *Limits
+	Retry   *Limits //isvalid:optional
+	Client  Client
+	URL     *url.URL
+}
+
+// Options are generated with a Validate method
+//isvalid:gen validate
+type Options struct {
+	Region string ` + "`validate:\"required\"`" + `
+}
+
+// Limits are validated by hand
+type Limits struct {
+	Max int
+}
+
+// Validate checks the limits
+func (l *Limits) Validate() error {
+	return nil
+}
+
+// Client has a Validate method with another signature
+type Client struct{}
+
+// Validate checks the client
+func (c Client) Validate(strict bool) error {
+	return nil
+}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that nested values are validated, pointers only when set
+	for _, want := range []string{
+		"if err := params.Options.Validate(); err != nil {\n\t\terrs = append(errs, isvalid.WithPath(\"Options\", err))\n\t}",
+		"if params.Limits != nil {\n\t\tif err := params.Limits.Validate(); err != nil {\n\t\t\terrs = append(errs, isvalid.WithPath(\"Limits\", err))\n\t\t}\n\t}",
+		"if params.Retry != nil {\n\t\tif err := params.Retry.Validate(); err != nil {",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// Other Validate methods and unresolved types are left alone
+	for _, unwanted := range []string{"params.Client.Validate", "params.URL.Validate"} {
+		if strings.Contains(codeStr, unwanted) {
+			t.Errorf("Generated code contains %s", unwanted)
+		}
+	}
+
+	// Validate methods generated for the structs of other files are called
+	// too, with or without type checking
+	content = `package test
+
+//isvalid:gen
+type TestService struct {
+	Region *Region
+}
+`
+	otherContent := `package test
+
+// Region is generated with a Validate method from another file
+//isvalid:gen validate
+type Region struct {
+	Name string ` + "`validate:\"required\"`" + `
+}
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "region.go"), []byte(otherContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	generator.Force = true
+	for _, typeCheck := range []bool{false, true} {
+		generator.TypeCheck = typeCheck
+		if err := generator.Generate(); err != nil {
+			t.Fatalf("Failed to generate code: %v", err)
+		}
+		generatedCode, err := os.ReadFile(generator.OutputFile)
+		if err != nil {
+			t.Fatalf("Failed to read generated code: %v", err)
+		}
+		if !strings.Contains(string(generatedCode), "if err := params.Region.Validate(); err != nil {") {
+			t.Errorf("Generated code with type checking %v doesn't validate a struct of another file", typeCheck)
+		}
+	}
+}
+
+func TestDive(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_dive.go")
+
+	// Create test content with rules for the elements of slices and maps
+	content := `package test
+
+// TestRouter is a test router
+//isvalid:gen
+type TestRouter struct {
+	Handlers []Handler ` + "`validate:\"min_len=1,dive\"`" + `
+	Backends map[string]*Backend ` + "`validate:\"dive,keys,min_len=2,endkeys\"`" + `
+	Weights  map[int]float64 ` + "`validate:\"dive,min=0\"`" + `
+	Names    Names ` + "`validate:\"optional,dive,required\"`" + `
+}
+
+// Handler is a test handler
+type Handler interface{ Handle() }
+
+// Backend is a test backend
+type Backend struct{}
+
+// Validate checks the backend
+func (b *Backend) Validate() error {
+	return nil
+}
+
+// Names is a test slice type
+type Names []string
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that the elements are validated with their paths
+	for _, want := range []string{
+		"\"fmt\"",
+		"if len(params.Handlers) < 1 {",
+		"for i, elem := range params.Handlers {\n\t\tif elem == nil {",
+		"Field:  fmt.Sprintf(\"Handlers[%d]\", i),",
+		"for key, elem := range params.Backends {\n\t\tif len(key) < 2 {",
+		"Field:  fmt.Sprintf(\"Backends[%q]\", key),",
+		"Value:  key,",
+		"if elem != nil {\n\t\t\tif err := elem.Validate(); err != nil {\n\t\t\t\terrs = append(errs, isvalid.WithPath(fmt.Sprintf(\"Backends[%q]\", key), err))",
+		"if elem < 0 {",
+		"Field:  fmt.Sprintf(\"Weights[%v]\", key),",
+		"for i, elem := range params.Names {\n\t\tif elem == \"\" {",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// Invalid uses of dive are reported
+	for _, tc := range []struct {
+		field string
+		err   string
+	}{
+		{"Name string `validate:\"dive,required\"`", "rule dive applies to slices, arrays and maps, not string"},
+		{"Names []string `validate:\"dive,keys,required,endkeys\"`", "rule keys applies to maps, not slice"},
+		{"Names map[string]string `validate:\"dive,keys,required\"`", "rule keys requires a matching endkeys"},
+		{"Names [][]string `validate:\"dive,dive,required\"`", "nested dive is not supported"},
+		{"Names []string `validate:\"required,keys\"`", "rule keys must follow dive"},
+		{"Names []string `validate:\"dive,min=1\"`", "dive: rule min applies to numbers, not string"},
+	} {
+		content := "package test\n\n//isvalid:gen\ntype TestRouter struct {\n\t" + tc.field + "\n}\n"
+		if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		err := generator.Generate()
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Generate() with %s: expected error %q, got %v", tc.field, tc.err, err)
+		}
+	}
+}
+
+func TestIncomparableFields(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_comparable.go")
+
+	// Types that can't be compared with their zero value can't be required,
+	// optional with other rules or defaulted
+	for _, tc := range []struct {
+		field string
+		err   string
+	}{
+		{"Item T `validate:\"required\"`", "rule required needs a comparable type, T can't be compared"},
+		{"In Inner `validate:\"required\"`", "rule required needs a comparable type, Inner can't be compared"},
+		{"In [2]Inner `validate:\"optional,len=2\"`", "rule optional needs a comparable type when combined with len"},
+		{"In Inner `default:\"Inner{}\"`", "default needs a comparable type, Inner can't be compared"},
+		{"Names []string `validate:\"dive,required\"`\n\tIns []Inner `validate:\"dive,required\"`", "dive: rule required needs a comparable type"},
+	} {
+		content := `package test
+
+//isvalid:gen
+type TestService[T any, K comparable] struct {
+	` + tc.field + `
+}
+
+// Inner holds a slice
+type Inner struct {
+	Names []string
+}
+`
+		if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		for _, typeCheck := range []bool{false, true} {
+			generator := NewGenerator(testFile)
+			generator.TypeCheck = typeCheck
+			err := generator.Generate()
+			if err == nil || !strings.Contains(err.Error(), tc.err) || !strings.Contains(err.Error(), "test_comparable.go:") {
+				t.Errorf("Generate() with %s and type checking %v: expected a positioned error %q, got %v", tc.field, typeCheck, tc.err, err)
+			}
+		}
+	}
+
+	// Comparable types are still checked
+	content := `package test
+
+//isvalid:gen
+type TestService[T any, K comparable, N interface{ ~int | ~int64 }] struct {
+	Key   K ` + "`validate:\"required\"`" + `
+	Count N ` + "`validate:\"required\"`" + `
+	Limit Limit ` + "`validate:\"required\"`" + `
+}
+
+// Limit is a comparable struct
+type Limit struct {
+	Max *int
+}
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	for _, typeCheck := range []bool{false, true} {
+		generator := NewGenerator(testFile)
+		generator.TypeCheck = typeCheck
+		generator.Force = true
+		if err := generator.Generate(); err != nil {
+			t.Errorf("Generate() with type checking %v: %v", typeCheck, err)
+		}
+	}
+}
+
+func TestPatternNames(t *testing.T) {
+	// Create a temporary test file
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_patterns.go")
+
+	// Create test content whose struct and field names run together
+	content := `package test
+
+// A is a test struct
+//isvalid:gen
+type A struct {
+	BName string ` + "`validate:\"regexp=^a$\"`" + `
+}
+
+// AB is a test struct
+//isvalid:gen
+type AB struct {
+	Name      string   ` + "`validate:\"regexp=^b$\"`" + `
+	Names     []string ` + "`validate:\"dive,regexp=^c$\"`" + `
+	NamesElem string   ` + "`validate:\"regexp=^d$\"`" + `
+}
+`
+
+	// Write test content to file
+	err := os.WriteFile(testFile, []byte(content), 0o644)
+	if err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Create generator
+	generator := NewGenerator(testFile)
+
+	// Generate code
+	err = generator.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	// Read generated code
+	generatedCode, err := os.ReadFile(generator.OutputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated code: %v", err)
+	}
+
+	codeStr := string(generatedCode)
+
+	// Check that every pattern has its own variable
+	for _, want := range []string{
+		"a_BNamePattern = regexp.MustCompile",
+		"aB_NamePattern       = regexp.MustCompile",
+		"aB_Names_elemPattern = regexp.MustCompile",
+		"aB_NamesElemPattern  = regexp.MustCompile",
+	} {
+		if !strings.Contains(codeStr, want) {
+			t.Errorf("Generated code doesn't contain %s", want)
+		}
+	}
+
+	// Variables that still clash are reported
+	for _, tc := range []struct {
+		content string
+		err     string
+	}{
+		{
+			"type AB struct {\n\tNames []string `validate:\"dive,regexp=^c$\"`\n\tNames_elem string `validate:\"regexp=^d$\"`\n}\n",
+			"pattern variable aB_Names_elemPattern is also generated for struct AB",
+		},
+		{
+			"type AB struct {\n\tName string `validate:\"regexp=^b$\"`\n}\n\nvar aB_NamePattern = 1\n",
+			"pattern variable aB_NamePattern is already declared in the package",
+		},
+	} {
+		content := "package test\n\n//isvalid:gen\n" + tc.content
+		if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		err := generator.Generate()
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected error %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestExcludedFields(t *testing.T) {
+	// Create a temporary module, so the generated code can be vetted
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_excluded.go")
+
+	// Create test content with fields the Params struct can't hold
+	content := `package test
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// TestService is a test service
+//isvalid:gen
+type TestService struct {
+	sync.Mutex
+	Guarded
+	Inner
+	*Base
+	Client *Client
+	Cache  *Client ` + "`isvalid:\"-\"`" + `
+	Hits   atomic.Int64 ` + "`isvalid:\"-\"`" + `
+}
+
+// Guarded holds a lock
+type Guarded struct {
+	mu sync.RWMutex
+}
+
+// Inner isn't comparable
+type Inner struct {
+	Names []string
+}
+
+// Base is embedded as a pointer
+type Base struct{}
+
+// Client is a test client
+type Client struct{}
+`
+
+	// Write test content to file
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	for _, typeCheck := range []bool{false, true} {
+		// Create generator
+		generator := NewGenerator(testFile)
+		generator.TypeCheck = typeCheck
+		generator.Force = true
+
+		// Generate code
+		if err := generator.Generate(); err != nil {
+			t.Fatalf("Failed to generate code: %v", err)
+		}
+
+		// Read generated code
+		generatedCode, err := os.ReadFile(generator.OutputFile)
+		if err != nil {
+			t.Fatalf("Failed to read generated code: %v", err)
+		}
+
+		codeStr := string(generatedCode)
+
+		// Check that only the fields the Params struct can hold are kept
+		for _, want := range []string{"\tBase   *Base\n", "\tClient *Client\n"} {
+			if !strings.Contains(codeStr, want) {
+				t.Errorf("Generated code with type checking %v doesn't contain %s", typeCheck, want)
+			}
+		}
+		for _, unwanted := range []string{"Mutex", "Guarded", "Inner", "Cache", "Hits"} {
+			if strings.Contains(codeStr, unwanted) {
+				t.Errorf("Generated code with type checking %v contains %s", typeCheck, unwanted)
+			}
+		}
+
+		runGo(t, dir, "vet", ".")
+	}
+
+	// The - option can't be combined with other options
+	content = `package test
+
+//isvalid:gen
+type TestService struct {
+	Client *Client ` + "`isvalid:\"-,include\"`" + `
+}
+
+// Client is a test client
+type Client struct{}
+`
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	err := NewGenerator(testFile).Generate()
+	if err == nil || !strings.Contains(err.Error(), "option - can't be combined with other options") {
+		t.Errorf("Expected an error for combined options, got %v", err)
+	}
+}
+
+// runGo runs the go tool with the given arguments on the package in dir, as a
+// module requiring this one, and fails the test if the command fails, such as
+// go vet on generated code that doesn't compile
+func runGo(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatalf("Failed to find the module root: %v", err)
+	}
+
+	goMod := "module test\n\ngo 1.21\n\nrequire github.com/strijmetkii/gen-isvalid v0.0.0\n\nreplace github.com/strijmetkii/gen-isvalid => " + root + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644); err != nil {
+		t.Fatalf("Failed to write go.mod: %v", err)
+	}
+
+	cmd := exec.Command(goTool, args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go %s failed: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func TestValidateMethodAfterFields(t *testing.T) {
+	// Create a temporary module, so the generated code can be run
+	dir := t.TempDir()
+	testFile := filepath.Join(dir, "test_proc.go")
+
+	// Create test content whose Validate method reads a required pointer
+	content := `package test
+
+import "errors"
+
+// Proc is a test processor
+//isvalid:gen
+type Proc struct {
+	MaxWorkers int
+	Config     *Config
+}
+
+// Config is a test config
+type Config struct {
+	BatchSize int
+}
+
+// Validate checks the workers against the batch size
+func (p *Proc) Validate() error {
+	if p.MaxWorkers > p.Config.BatchSize*2 {
+		return errors.New("too many workers")
+	}
+	return nil
+}
+`
+
+	// The constructor reports the missing Config instead of calling Validate
+	testContent := `package test
+
+import "testing"
+
+func TestNewProc(t *testing.T) {
+	_, err := NewProc(ProcParams{MaxWorkers: 3})
+	if err == nil || err.Error() != "Config is required" {
+		t.Errorf("NewProc() error = %v, want Config is required", err)
+	}
+
+	_, err = NewProc(ProcParams{MaxWorkers: 3, Config: &Config{BatchSize: 1}})
+	if err == nil || err.Error() != "too many workers" {
+		t.Errorf("NewProc() error = %v, want too many workers", err)
+	}
+}
+`
+
+	// Write test content to files
+	if err := os.WriteFile(testFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "proc_test.go"), []byte(testContent), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	// Generate code
+	if err := NewGenerator(testFile).Generate(); err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	runGo(t, dir, "test", ".")
+}
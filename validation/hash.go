@@ -0,0 +1,52 @@
+package validation
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// hashPrefix starts the header line that records the source hash in generated files
+const hashPrefix = "// Source hash: "
+
+// sourceHash returns a content hash of the template data, which holds
+// everything read from the source struct definitions. The template itself is
+// part of the hash, so that a new version of the generator regenerates its
+// output as well.
+func sourceHash(data map[string]interface{}) (string, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(codeTemplate))
+	h.Write(encoded)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readHash returns the source hash recorded in the header of a generated file,
+// or an empty string if the file doesn't exist or has no hash
+func readHash(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	// The hash is part of the header comment before the package clause
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if hash, ok := strings.CutPrefix(line, hashPrefix); ok {
+			return strings.TrimSpace(hash)
+		}
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+package validation
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// funcDecls holds the functions and methods declared in the files of a package
+type funcDecls struct {
+	// funcs maps the names of the functions to their declarations
+	funcs map[string]*ast.FuncDecl
+	// methods maps the names of the receiver types to their methods
+	methods map[string]map[string]*ast.FuncDecl
+}
+
+// newFuncDecls collects the functions and methods of the given files
+func newFuncDecls(files []*ast.File) *funcDecls {
+	d := &funcDecls{
+		funcs:   make(map[string]*ast.FuncDecl),
+		methods: make(map[string]map[string]*ast.FuncDecl),
+	}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+				d.funcs[funcDecl.Name.Name] = funcDecl
+				continue
+			}
+			recv := receiverName(funcDecl.Recv.List[0].Type)
+			if d.methods[recv] == nil {
+				d.methods[recv] = make(map[string]*ast.FuncDecl)
+			}
+			d.methods[recv][funcDecl.Name.Name] = funcDecl
+		}
+	}
+	return d
+}
+
+// receiverName returns the name of the type of a method receiver, without
+// pointer and type parameters
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.ParenExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	default:
+		return ""
+	}
+}
+
+// findHooks looks up the hooks declared for every struct: a
+// validate<Name>Params function, whose error is joined with those of the
+// fields, and the Validate and initialize methods of the struct, called once
+// it is built. Declarations with those names but other signatures are an
+// error.
+func findHooks(fset *token.FileSet, structs []StructInfo, decls *funcDecls) error {
+	for i := range structs {
+		s := &structs[i]
+
+		name := "validate" + s.Name + "Params"
+		if fn, ok := decls.funcs[name]; ok {
+			if !isParamsHook(fn.Type, s.Name+"Params") {
+				return fmt.Errorf("%s: %s must be declared as func(%sParams) error", fset.Position(fn.Pos()), name, s.Name)
+			}
+			s.ParamsHook = true
+		}
+
+		if method, ok := decls.methods[s.Name]["Validate"]; ok {
+			if !isErrorFunc(method.Type) || method.Type.Params.NumFields() != 0 {
+				return fmt.Errorf("%s: %s.Validate must be declared as func() error", fset.Position(method.Pos()), s.Name)
+			}
+			if s.ValidateStruct {
+				return fmt.Errorf("%s: struct %s declares a Validate method, which conflicts with the validate marker argument", fset.Position(method.Pos()), s.Name)
+			}
+			s.ValidateMethod = true
+		}
+
+		if method, ok := decls.methods[s.Name]["initialize"]; ok {
+			if !isErrorFunc(method.Type) || method.Type.Params.NumFields() != 0 {
+				return fmt.Errorf("%s: %s.initialize must be declared as func() error", fset.Position(method.Pos()), s.Name)
+			}
+			s.InitHook = true
+		}
+	}
+	return nil
+}
+
+// findNested marks the fields whose values, or whose elements when the rules
+// of the field dive into them, have a Validate method, either declared in
+// the package, generated for a struct of any file of the package marked with
+// the validate argument or, when type-checked, declared by a type of another
+// package.
+// Pointers to such values are validated unless nil.
+func findNested(structs, others []StructInfo, decls *funcDecls, info *types.Info) {
+	generated := make(map[string]bool)
+	for _, group := range [][]StructInfo{structs, others} {
+		for _, s := range group {
+			if s.ValidateStruct {
+				generated[s.Name] = true
+			}
+		}
+	}
+
+	var mark func(fields []FieldInfo)
+	mark = func(fields []FieldInfo) {
+		for i := range fields {
+			f := &fields[i]
+			if f.Flatten {
+				mark(f.Flattened)
+				continue
+			}
+			if f.typeExpr != nil && mayValidate(f.Kind) {
+				f.Nested = hasValidateMethod(f.typeExpr, decls, generated, info)
+			}
+			if f.Dive != nil && f.Dive.elemExpr != nil && mayValidate(f.Dive.elemKind) {
+				f.Dive.Nested = hasValidateMethod(f.Dive.elemExpr, decls, generated, info)
+			}
+		}
+	}
+	for i := range structs {
+		mark(structs[i].Fields)
+	}
+}
+
+// mayValidate reports whether values of the kind may have a Validate method
+// called by the generated code
+func mayValidate(k FieldKind) bool {
+	return k == KindStruct || k == KindPointer || k == KindValue
+}
+
+// hasValidateMethod reports whether the values of a type, or those a pointer
+// type points to, have a Validate method returning an error only
+func hasValidateMethod(expr ast.Expr, decls *funcDecls, generated map[string]bool, info *types.Info) bool {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+
+	if info != nil {
+		if t := info.TypeOf(expr); t != nil && t != types.Typ[types.Invalid] {
+			if _, ok := t.Underlying().(*types.Interface); ok {
+				return false
+			}
+			if hasValidateType(t) {
+				return true
+			}
+		}
+	}
+
+	if _, ok := expr.(*ast.SelectorExpr); ok {
+		// Types of other packages can't be resolved without type information
+		return false
+	}
+	name := receiverName(expr)
+	if method, ok := decls.methods[name]["Validate"]; ok {
+		return isErrorFunc(method.Type) && method.Type.Params.NumFields() == 0
+	}
+	return generated[name]
+}
+
+// hasValidateType reports whether a type has a Validate method returning an
+// error only, including the methods declared with a pointer receiver
+func hasValidateType(t types.Type) bool {
+	if _, ok := t.(*types.Pointer); !ok {
+		t = types.NewPointer(t)
+	}
+	sel := types.NewMethodSet(t).Lookup(nil, "Validate")
+	if sel == nil {
+		return false
+	}
+	sig, ok := sel.Type().(*types.Signature)
+	return ok && sig.Params().Len() == 0 && sig.Results().Len() == 1 &&
+		types.Identical(sig.Results().At(0).Type(), types.Universe.Lookup("error").Type())
+}
+
+// isParamsHook reports whether a function takes a single parameter of the
+// given Params type, possibly instantiated, and returns an error
+func isParamsHook(t *ast.FuncType, paramsName string) bool {
+	if !isErrorFunc(t) || t.Params.NumFields() != 1 {
+		return false
+	}
+	expr := t.Params.List[0].Type
+	switch index := expr.(type) {
+	case *ast.IndexExpr:
+		expr = index.X
+	case *ast.IndexListExpr:
+		expr = index.X
+	}
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == paramsName
+}
+
+// isErrorFunc reports whether a function type returns an error only
+func isErrorFunc(t *ast.FuncType) bool {
+	if t.Results.NumFields() != 1 {
+		return false
+	}
+	ident, ok := t.Results.List[0].Type.(*ast.Ident)
+	return ok && ident.Name == "error"
+}
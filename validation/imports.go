@@ -0,0 +1,302 @@
+package validation
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// runtimePackage is the import path of the package holding the types used by
+// the generated code
+const runtimePackage = "github.com/strijmetkii/gen-isvalid/isvalid"
+
+// Import is a package imported by the generated code
+type Import struct {
+	// Name is the explicit name of the import, empty to use the package name
+	Name string
+	// Path is the import path of the package
+	Path string
+}
+
+// IsStd reports whether the import is a package of the standard library,
+// whose import paths have no dot in their first element
+func (i Import) IsStd() bool {
+	first, _, _ := strings.Cut(i.Path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// typeRefs records the package qualifiers and the unresolved identifiers
+// used by the field types of a struct
+type typeRefs struct {
+	// qualifiers are the package names of qualified identifiers such as http.Client
+	qualifiers map[string]bool
+	// idents are the identifiers not declared in the package, which may
+	// come from dot imports
+	idents []*ast.Ident
+}
+
+// collect records the references of the given type expression. Names of
+// parameters and results in function types and of fields in inline structs
+// are skipped.
+func (r *typeRefs) collect(expr ast.Expr, resolver *kindResolver, typeParams map[string]bool) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Field:
+			r.collect(n.Type, resolver, typeParams)
+			return false
+		case *ast.SelectorExpr:
+			if ident, ok := n.X.(*ast.Ident); ok {
+				if r.qualifiers == nil {
+					r.qualifiers = make(map[string]bool)
+				}
+				r.qualifiers[ident.Name] = true
+				return false
+			}
+		case *ast.Ident:
+			if !typeParams[n.Name] && !resolver.declared[n.Name] && types.Universe.Lookup(n.Name) == nil {
+				r.idents = append(r.idents, n)
+			}
+		}
+		return true
+	})
+}
+
+// resolveImports returns the imports needed by the generated code: the
+// packages used by the generated functions themselves, and the imports of the
+// package files that the field types refer to. The imports of the file
+// declaring a struct take precedence over those of the other files.
+func resolveImports(structs []StructInfo, files []*ast.File, info *types.Info) ([]Import, error) {
+	imports := []Import{{Path: "errors"}}
+	for _, s := range structs {
+		if len(s.Patterns) > 0 {
+			imports = append(imports, Import{Path: "regexp"})
+			break
+		}
+	}
+	for _, s := range structs {
+		if hasChecks(s) {
+			imports = append(imports, Import{Path: runtimePackage})
+			break
+		}
+	}
+	for _, s := range structs {
+		if hasDive(s) {
+			imports = append(imports, Import{Path: "fmt"})
+			break
+		}
+	}
+
+	for _, s := range structs {
+		ordered := append([]*ast.File{s.file}, files...)
+
+		qualifiers := make([]string, 0, len(s.refs.qualifiers))
+		for qualifier := range s.refs.qualifiers {
+			qualifiers = append(qualifiers, qualifier)
+		}
+		sort.Strings(qualifiers)
+
+		for _, qualifier := range qualifiers {
+			spec := findImport(ordered, qualifier, info)
+			if spec == nil {
+				return nil, fmt.Errorf("struct %s: package %s is not imported", s.Name, qualifier)
+			}
+			imports = append(imports, importOf(spec))
+		}
+
+		specs, err := dotImports(s.file, s.refs.idents, info)
+		if err != nil {
+			return nil, fmt.Errorf("struct %s: %w", s.Name, err)
+		}
+		for _, spec := range specs {
+			imports = append(imports, importOf(spec))
+		}
+	}
+
+	return mergeImports(imports)
+}
+
+// hasChecks reports whether any field of the struct is validated
+func hasChecks(s StructInfo) bool {
+	for _, field := range s.ParamFields() {
+		if len(field.Checks) > 0 || field.Nested || hasDiveChecks(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDive reports whether the elements of any field of the struct are
+// validated, which reports their paths with fmt
+func hasDive(s StructInfo) bool {
+	for _, field := range s.ParamFields() {
+		if hasDiveChecks(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDiveChecks reports whether the elements or keys of a field are validated
+func hasDiveChecks(field FieldInfo) bool {
+	return field.Dive != nil && (field.Dive.UsesElem() || len(field.Dive.KeyChecks) > 0)
+}
+
+// findImport returns the first import of the files that is referred to by
+// the given qualifier
+func findImport(files []*ast.File, qualifier string, info *types.Info) *ast.ImportSpec {
+	for _, file := range files {
+		for _, spec := range file.Imports {
+			if importName(spec, info) == qualifier {
+				return spec
+			}
+		}
+	}
+	return nil
+}
+
+// dotImports returns the dot imports of the file that declare the given
+// identifiers. Without type information the declaring package is unknown, so
+// a single dot import is kept when an identifier can't be resolved, and
+// several are an error since some of them would be unused.
+func dotImports(file *ast.File, idents []*ast.Ident, info *types.Info) ([]*ast.ImportSpec, error) {
+	if len(idents) == 0 {
+		return nil, nil
+	}
+
+	used := make(map[string]bool)
+	for _, ident := range idents {
+		if info == nil {
+			break
+		}
+		if obj := info.Uses[ident]; obj != nil && obj.Pkg() != nil {
+			used[obj.Pkg().Path()] = true
+		}
+	}
+
+	var specs, dots []*ast.ImportSpec
+	for _, spec := range file.Imports {
+		if spec.Name == nil || spec.Name.Name != "." {
+			continue
+		}
+		dots = append(dots, spec)
+		if info == nil || used[importPath(spec)] {
+			specs = append(specs, spec)
+		}
+	}
+
+	if info == nil && len(dots) > 1 {
+		paths := make([]string, 0, len(dots))
+		for _, spec := range dots {
+			paths = append(paths, importPath(spec))
+		}
+		return nil, fmt.Errorf("can't tell which of the dot imports %s declares %s without type checking, use -typecheck", strings.Join(paths, ", "), idents[0].Name)
+	}
+	return specs, nil
+}
+
+// mergeImports removes duplicate imports and sorts them by path. Two imports
+// of different packages under the same name are an error.
+func mergeImports(imports []Import) ([]Import, error) {
+	seen := make(map[Import]bool)
+	paths := make(map[string]string)
+	var result []Import
+	for _, imp := range imports {
+		if seen[imp] {
+			continue
+		}
+		seen[imp] = true
+
+		name := imp.Name
+		if name == "" {
+			name = guessPackageName(imp.Path)
+		}
+		if name != "." {
+			if other, ok := paths[name]; ok && other != imp.Path {
+				return nil, fmt.Errorf("packages %s and %s are both imported as %s", other, imp.Path, name)
+			}
+			paths[name] = imp.Path
+		}
+
+		result = append(result, imp)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Path != result[j].Path {
+			return result[i].Path < result[j].Path
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// importOf returns the import declared by the given spec
+func importOf(spec *ast.ImportSpec) Import {
+	imp := Import{Path: importPath(spec)}
+	if spec.Name != nil {
+		imp.Name = spec.Name.Name
+	}
+	return imp
+}
+
+// importPath returns the unquoted path of an import spec
+func importPath(spec *ast.ImportSpec) string {
+	p, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return spec.Path.Value
+	}
+	return p
+}
+
+// importName returns the name under which an import is referred to in its
+// file. The package name of an import without an explicit name comes from the
+// type-checked package, or is guessed from the import path.
+func importName(spec *ast.ImportSpec, info *types.Info) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	if info != nil {
+		if pkgName, ok := info.Implicits[spec].(*types.PkgName); ok {
+			return pkgName.Imported().Name()
+		}
+	}
+	return guessPackageName(importPath(spec))
+}
+
+// guessPackageName guesses the package name of an import path the way
+// goimports does: the last element of the path, skipping a major version
+// suffix such as v2, without a go- prefix and cut at the first character that
+// isn't valid in an identifier
+func guessPackageName(importPath string) string {
+	name := path.Base(importPath)
+	if isMajorVersion(name) {
+		if dir := path.Dir(importPath); dir != "." {
+			name = path.Base(dir)
+		}
+	}
+	name = strings.TrimPrefix(name, "go-")
+	if i := strings.IndexFunc(name, func(r rune) bool {
+		return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// isMajorVersion reports whether a path element is a major version suffix
+func isMajorVersion(elem string) bool {
+	rest, ok := strings.CutPrefix(elem, "v")
+	if !ok || rest == "" {
+		return false
+	}
+	for _, r := range rest {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,396 @@
+package validation
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// FieldKind classifies a field type by the way it can be validated
+type FieldKind int
+
+const (
+	// KindValue is any other type that cannot be nil, or a type that can't be resolved
+	KindValue FieldKind = iota
+	// KindPointer is a pointer type
+	KindPointer
+	// KindInterface is an interface type
+	KindInterface
+	// KindMap is a map type
+	KindMap
+	// KindSlice is a slice type
+	KindSlice
+	// KindFunc is a function type
+	KindFunc
+	// KindChan is a channel type
+	KindChan
+	// KindString is a string type
+	KindString
+	// KindNumber is an integer, floating-point or complex type
+	KindNumber
+	// KindBool is a boolean type
+	KindBool
+	// KindStruct is a struct type
+	KindStruct
+	// KindArray is an array type
+	KindArray
+)
+
+// Nilable reports whether values of the kind can be compared to nil
+func (k FieldKind) Nilable() bool {
+	switch k {
+	case KindPointer, KindInterface, KindMap, KindSlice, KindFunc, KindChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// HasLen reports whether the builtin len can be applied to values of the kind
+func (k FieldKind) HasLen() bool {
+	switch k {
+	case KindString, KindSlice, KindMap, KindArray, KindChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// String returns the name of the kind
+func (k FieldKind) String() string {
+	switch k {
+	case KindPointer:
+		return "pointer"
+	case KindInterface:
+		return "interface"
+	case KindMap:
+		return "map"
+	case KindSlice:
+		return "slice"
+	case KindFunc:
+		return "func"
+	case KindChan:
+		return "chan"
+	case KindString:
+		return "string"
+	case KindNumber:
+		return "number"
+	case KindBool:
+		return "bool"
+	case KindStruct:
+		return "struct"
+	case KindArray:
+		return "array"
+	default:
+		return "value"
+	}
+}
+
+// kindResolver classifies field types using the type declarations of the
+// package files, or the type-checked package when available
+type kindResolver struct {
+	// decls maps the names of the types declared in the files to their definitions
+	decls map[string]ast.Expr
+	// declared holds every name declared at package level in the files
+	declared map[string]bool
+	// info holds the resolved types of the package, nil unless type-checked
+	info *types.Info
+}
+
+// newKindResolver collects the declarations of the given files
+func newKindResolver(files []*ast.File) *kindResolver {
+	r := &kindResolver{
+		decls:    make(map[string]ast.Expr),
+		declared: make(map[string]bool),
+	}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					r.declared[decl.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						r.decls[spec.Name.Name] = spec.Type
+						r.declared[spec.Name.Name] = true
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							r.declared[name.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	return r
+}
+
+// kindOf returns the kind of the given type expression. Type parameters of the
+// enclosing struct are passed in typeParams, since they shadow declared types
+// and can never be compared to nil.
+func (r *kindResolver) kindOf(expr ast.Expr, typeParams map[string]bool) FieldKind {
+	if r.info != nil {
+		if t := r.info.TypeOf(expr); t != nil && t != types.Typ[types.Invalid] {
+			return kindOfType(t)
+		}
+	}
+	return r.resolve(expr, typeParams, make(map[string]bool))
+}
+
+func (r *kindResolver) resolve(expr ast.Expr, typeParams, seen map[string]bool) FieldKind {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return KindPointer
+	case *ast.InterfaceType:
+		return KindInterface
+	case *ast.MapType:
+		return KindMap
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return KindSlice
+		}
+		return KindArray
+	case *ast.StructType:
+		return KindStruct
+	case *ast.FuncType:
+		return KindFunc
+	case *ast.ChanType:
+		return KindChan
+	case *ast.ParenExpr:
+		return r.resolve(t.X, typeParams, seen)
+	case *ast.IndexExpr:
+		return r.resolve(t.X, typeParams, seen)
+	case *ast.IndexListExpr:
+		return r.resolve(t.X, typeParams, seen)
+	case *ast.Ident:
+		if typeParams[t.Name] {
+			return KindValue
+		}
+		if def, ok := r.decls[t.Name]; ok {
+			if seen[t.Name] {
+				return KindValue
+			}
+			seen[t.Name] = true
+			return r.resolve(def, typeParams, seen)
+		}
+		return basicKinds[t.Name]
+	default:
+		// Qualified types from other packages can't be resolved without type information
+		return KindValue
+	}
+}
+
+// basicInfo returns the properties of the basic type underlying the given
+// type, such as types.IsInteger or types.IsUnsigned, or 0 if the type isn't a
+// basic type or can't be resolved
+func (r *kindResolver) basicInfo(expr ast.Expr, typeParams map[string]bool) types.BasicInfo {
+	if r.info != nil {
+		if t := r.info.TypeOf(expr); t != nil && t != types.Typ[types.Invalid] {
+			if basic, ok := t.Underlying().(*types.Basic); ok {
+				return basic.Info()
+			}
+			return 0
+		}
+	}
+
+	seen := make(map[string]bool)
+	for {
+		switch t := expr.(type) {
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.Ident:
+			if typeParams[t.Name] {
+				return 0
+			}
+			if def, ok := r.decls[t.Name]; ok {
+				if seen[t.Name] {
+					return 0
+				}
+				seen[t.Name] = true
+				expr = def
+				continue
+			}
+			if obj, ok := types.Universe.Lookup(t.Name).(*types.TypeName); ok {
+				if basic, ok := obj.Type().(*types.Basic); ok {
+					return basic.Info()
+				}
+			}
+			return 0
+		default:
+			return 0
+		}
+	}
+}
+
+// comparable reports whether values of the given type can be compared with
+// ==. Without type information, type parameters are comparable if their
+// constraint is, and types that can't be resolved are assumed to be.
+func (r *kindResolver) comparable(expr ast.Expr, constraints map[string]ast.Expr) bool {
+	if r.info != nil {
+		if t := r.info.TypeOf(expr); t != nil && t != types.Typ[types.Invalid] {
+			return types.Comparable(t)
+		}
+	}
+	return r.comparableExpr(expr, constraints, make(map[string]bool))
+}
+
+func (r *kindResolver) comparableExpr(expr ast.Expr, constraints map[string]ast.Expr, seen map[string]bool) bool {
+	switch t := expr.(type) {
+	case *ast.MapType, *ast.FuncType:
+		return false
+	case *ast.ArrayType:
+		return t.Len != nil && r.comparableExpr(t.Elt, constraints, seen)
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if !r.comparableExpr(field.Type, constraints, seen) {
+				return false
+			}
+		}
+		return true
+	case *ast.ParenExpr:
+		return r.comparableExpr(t.X, constraints, seen)
+	case *ast.IndexExpr:
+		return r.comparableExpr(t.X, nil, seen)
+	case *ast.IndexListExpr:
+		return r.comparableExpr(t.X, nil, seen)
+	case *ast.Ident:
+		if constraint, ok := constraints[t.Name]; ok {
+			return r.comparableConstraint(constraint, seen)
+		}
+		if def, ok := r.decls[t.Name]; ok && !seen[t.Name] {
+			seen[t.Name] = true
+			return r.comparableExpr(def, nil, seen)
+		}
+		return true
+	default:
+		// Pointers, channels and interfaces are comparable, and qualified
+		// types can't be resolved without type information
+		return true
+	}
+}
+
+// holdsLock reports whether values of the given type hold a lock, which must
+// not be copied: a type with Lock and Unlock methods such as sync.Mutex, or a
+// struct or array holding one. Without type information, the types of the
+// sync and sync/atomic packages are assumed to be locks.
+func (r *kindResolver) holdsLock(expr ast.Expr) bool {
+	if r.info != nil {
+		if t := r.info.TypeOf(expr); t != nil && t != types.Typ[types.Invalid] {
+			return holdsLockType(t, make(map[types.Type]bool))
+		}
+	}
+	return r.holdsLockExpr(expr, make(map[string]bool))
+}
+
+func holdsLockType(t types.Type, seen map[types.Type]bool) bool {
+	if _, ok := t.(*types.Pointer); ok || seen[t] {
+		return false
+	}
+	seen[t] = true
+	if _, ok := t.Underlying().(*types.Interface); !ok {
+		methods := types.NewMethodSet(types.NewPointer(t))
+		if methods.Lookup(nil, "Lock") != nil && methods.Lookup(nil, "Unlock") != nil {
+			return true
+		}
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if holdsLockType(u.Field(i).Type(), seen) {
+				return true
+			}
+		}
+	case *types.Array:
+		return holdsLockType(u.Elem(), seen)
+	}
+	return false
+}
+
+func (r *kindResolver) holdsLockExpr(expr ast.Expr, seen map[string]bool) bool {
+	switch t := expr.(type) {
+	case *ast.SelectorExpr:
+		ident, ok := t.X.(*ast.Ident)
+		return ok && (ident.Name == "sync" || ident.Name == "atomic")
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if r.holdsLockExpr(field.Type, seen) {
+				return true
+			}
+		}
+		return false
+	case *ast.ArrayType:
+		return t.Len != nil && r.holdsLockExpr(t.Elt, seen)
+	case *ast.ParenExpr:
+		return r.holdsLockExpr(t.X, seen)
+	case *ast.Ident:
+		if def, ok := r.decls[t.Name]; ok && !seen[t.Name] {
+			seen[t.Name] = true
+			return r.holdsLockExpr(def, seen)
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// comparableConstraint reports whether the types satisfying a constraint are
+// comparable: the constraint embeds comparable, or is a union of comparable
+// types. Constraints with methods only, such as any, aren't.
+func (r *kindResolver) comparableConstraint(expr ast.Expr, seen map[string]bool) bool {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "comparable":
+			return true
+		case "any":
+			return false
+		}
+		if def, ok := r.decls[t.Name]; ok && !seen[t.Name] {
+			seen[t.Name] = true
+			return r.comparableConstraint(def, seen)
+		}
+		return true
+	case *ast.InterfaceType:
+		for _, elem := range t.Methods.List {
+			if len(elem.Names) == 0 && r.comparableConstraint(elem.Type, seen) {
+				return true
+			}
+		}
+		return false
+	case *ast.BinaryExpr:
+		return r.comparableConstraint(t.X, seen) && r.comparableConstraint(t.Y, seen)
+	case *ast.UnaryExpr:
+		return r.comparableExpr(t.X, nil, seen)
+	case *ast.ParenExpr:
+		return r.comparableConstraint(t.X, seen)
+	default:
+		return r.comparableExpr(expr, nil, seen)
+	}
+}
+
+// basicKinds maps the predeclared types to their kinds
+var basicKinds = map[string]FieldKind{
+	"any":        KindInterface,
+	"error":      KindInterface,
+	"string":     KindString,
+	"bool":       KindBool,
+	"int":        KindNumber,
+	"int8":       KindNumber,
+	"int16":      KindNumber,
+	"int32":      KindNumber,
+	"int64":      KindNumber,
+	"uint":       KindNumber,
+	"uint8":      KindNumber,
+	"uint16":     KindNumber,
+	"uint32":     KindNumber,
+	"uint64":     KindNumber,
+	"uintptr":    KindNumber,
+	"byte":       KindNumber,
+	"rune":       KindNumber,
+	"float32":    KindNumber,
+	"float64":    KindNumber,
+	"complex64":  KindNumber,
+	"complex128": KindNumber,
+}
@@ -0,0 +1,374 @@
+package validation
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// validateTag is the struct tag holding the validation rules of a field
+const validateTag = "validate"
+
+// optionsTag is the struct tag holding the generator options of a field
+const optionsTag = "isvalid"
+
+// defaultTag is the struct tag holding the default value of a field, which
+// can also be given with the default option of the options tag
+const defaultTag = "default"
+
+// optionalMarker is the comment that marks a field as optional, equivalent to
+// the optional rule
+const optionalMarker = "//isvalid:optional"
+
+// Rule is a single validation rule read from the validate tag of a field
+type Rule struct {
+	// Name is the name of the rule, such as required or min
+	Name string
+	// Param is the parameter of the rule, empty if it takes none
+	Param string
+}
+
+// Check is a single condition in the generated validation function
+type Check struct {
+	// Cond is the Go expression that holds when the field is invalid
+	Cond string
+	// Rule is the name of the rule reported when Cond holds
+	Rule string
+	// Param is the parameter of the rule, empty if it takes none
+	Param string
+}
+
+// Default is the value assigned to a field of the Params struct that isn't set
+type Default struct {
+	// Cond is the Go expression that holds when the field isn't set
+	Cond string
+	// Value is the Go expression assigned to the field
+	Value string
+}
+
+// Pattern is a regular expression compiled once by the generated code
+type Pattern struct {
+	// Var is the name of the package-level variable holding the expression,
+	// such as router_NamesPattern. The underscore keeps the names of struct A
+	// with field BName and struct AB with field Name apart.
+	Var string
+	// Expr is the regular expression
+	Expr string
+}
+
+// parseRules parses the rules from the given tag of a struct field. Rules are
+// separated by commas, and parameters follow an equals sign. Since regular
+// expressions may contain commas, regexp must be the last rule.
+func parseRules(tag *ast.BasicLit, key string) ([]Rule, error) {
+	value, _, err := lookupTag(tag, key)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := value
+	var rules []Rule
+	for spec != "" {
+		part := spec
+		if !strings.HasPrefix(spec, "regexp=") {
+			part, spec, _ = strings.Cut(spec, ",")
+		} else {
+			spec = ""
+		}
+
+		name, param, _ := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("empty rule in %s tag %q", key, value)
+		}
+		rules = append(rules, Rule{Name: name, Param: param})
+	}
+
+	return rules, nil
+}
+
+// lookupTag returns the value of the given key in the tag of a struct field,
+// and whether the key is present
+func lookupTag(tag *ast.BasicLit, key string) (string, bool, error) {
+	if tag == nil {
+		return "", false, nil
+	}
+
+	value, err := strconv.Unquote(tag.Value)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid struct tag %s: %w", tag.Value, err)
+	}
+
+	spec, ok := reflect.StructTag(value).Lookup(key)
+	return spec, ok, nil
+}
+
+// hasOptionalMarker checks if the doc or line comment of the field contains the optional marker
+func hasOptionalMarker(field *ast.Field) bool {
+	for _, group := range []*ast.CommentGroup{field.Doc, field.Comment} {
+		if group == nil {
+			continue
+		}
+		for _, comment := range group.List {
+			if strings.TrimSpace(comment.Text) == optionalMarker {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// buildChecks builds the checks of the value held by expr, a field of the
+// given struct or one of its elements, from its kind and rules. Nilable values
+// are required unless marked optional, and the rules of an optional value only
+// apply when it isn't the zero value. Regular expressions used by the checks
+// are added to the patterns of the struct.
+func buildChecks(s *StructInfo, f FieldInfo, expr string) ([]Check, error) {
+	required, optional := false, false
+	for _, rule := range f.Rules {
+		switch rule.Name {
+		case "required":
+			required = true
+		case "optional":
+			optional = true
+		}
+	}
+	if required && optional {
+		return nil, fmt.Errorf("rules required and optional are mutually exclusive")
+	}
+
+	if f.incomparable && required {
+		return nil, fmt.Errorf("rule required needs a comparable type, %s can't be compared", f.Type)
+	}
+
+	var checks []Check
+	if required || (f.Kind.Nilable() && !optional) {
+		checks = append(checks, Check{
+			Cond: zeroCond(expr, f),
+			Rule: "required",
+		})
+	}
+
+	guard := ""
+	if optional {
+		guard = nonZeroCond(expr, f) + " && "
+	}
+
+	for _, rule := range f.Rules {
+		var check Check
+
+		switch rule.Name {
+		case "required", "optional":
+			continue
+		}
+		if optional && f.incomparable {
+			return nil, fmt.Errorf("rule optional needs a comparable type when combined with %s, %s can't be compared", rule.Name, f.Type)
+		}
+
+		switch rule.Name {
+		case "min", "max":
+			if f.Kind != KindNumber && f.Kind != KindValue {
+				return nil, fmt.Errorf("rule %s applies to numbers, not %s", rule.Name, f.Kind)
+			}
+			n, err := strconv.ParseFloat(rule.Param, 64)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s requires a number, got %q", rule.Name, rule.Param)
+			}
+			if f.basic&types.IsInteger != 0 && n != math.Trunc(n) {
+				return nil, fmt.Errorf("rule %s requires an integer for %s, got %q", rule.Name, f.Type, rule.Param)
+			}
+			if f.basic&types.IsUnsigned != 0 && n < 0 {
+				return nil, fmt.Errorf("rule %s requires a non-negative number for %s, got %q", rule.Name, f.Type, rule.Param)
+			}
+			if rule.Name == "min" {
+				check = Check{Cond: expr + " < " + rule.Param}
+			} else {
+				check = Check{Cond: expr + " > " + rule.Param}
+			}
+
+		case "len", "min_len", "max_len":
+			if !f.Kind.HasLen() && f.Kind != KindValue {
+				return nil, fmt.Errorf("rule %s applies to strings, slices, arrays and maps, not %s", rule.Name, f.Kind)
+			}
+			if n, err := strconv.Atoi(rule.Param); err != nil || n < 0 {
+				return nil, fmt.Errorf("rule %s requires a non-negative integer, got %q", rule.Name, rule.Param)
+			}
+			switch rule.Name {
+			case "len":
+				check = Check{Cond: "len(" + expr + ") != " + rule.Param}
+			case "min_len":
+				check = Check{Cond: "len(" + expr + ") < " + rule.Param}
+			default:
+				check = Check{Cond: "len(" + expr + ") > " + rule.Param}
+			}
+
+		case "oneof":
+			if f.Kind != KindString && f.Kind != KindNumber && f.Kind != KindValue {
+				return nil, fmt.Errorf("rule oneof applies to strings and numbers, not %s", f.Kind)
+			}
+			values := strings.Fields(rule.Param)
+			if len(values) == 0 {
+				return nil, fmt.Errorf("rule oneof requires at least one value")
+			}
+			conds := make([]string, 0, len(values))
+			for _, value := range values {
+				if _, err := strconv.ParseFloat(value, 64); f.Kind == KindString || err != nil {
+					if f.Kind == KindNumber {
+						return nil, fmt.Errorf("rule oneof requires numbers, got %q", value)
+					}
+					value = strconv.Quote(value)
+				}
+				conds = append(conds, expr+" != "+value)
+			}
+			check = Check{Cond: strings.Join(conds, " && ")}
+
+		case "regexp":
+			if f.Kind != KindString && f.Kind != KindValue {
+				return nil, fmt.Errorf("rule regexp applies to strings, not %s", f.Kind)
+			}
+			if _, err := regexp.Compile(rule.Param); err != nil {
+				return nil, fmt.Errorf("rule regexp: %w", err)
+			}
+			pattern := Pattern{Var: lowerFirst(s.Name) + "_" + f.Name + "Pattern", Expr: rule.Param}
+			s.Patterns = append(s.Patterns, pattern)
+			check = Check{Cond: "!" + pattern.Var + ".MatchString(" + expr + ")"}
+
+		default:
+			return nil, fmt.Errorf("unknown rule %q", rule.Name)
+		}
+
+		check.Cond = guard + check.Cond
+		check.Rule, check.Param = rule.Name, rule.Param
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
+
+// buildDefault builds the default of a field from the given value. Strings are
+// quoted, durations such as 30s are converted to constant expressions, and any
+// other value is used as Go expression.
+func buildDefault(f FieldInfo, value string) (*Default, error) {
+	expr := "params." + f.Name
+
+	switch {
+	case f.Kind == KindString:
+		value = strconv.Quote(value)
+	case isDurationType(f.Type):
+		if d, err := time.ParseDuration(value); err == nil {
+			value = durationExpr(d, strings.TrimSuffix(f.Type, "Duration"))
+		}
+	}
+
+	if _, err := parser.ParseExpr(value); err != nil {
+		return nil, fmt.Errorf("default %q is not a Go expression", value)
+	}
+	if f.incomparable {
+		return nil, fmt.Errorf("default needs a comparable type, %s can't be compared", f.Type)
+	}
+	return &Default{Cond: zeroCond(expr, f), Value: value}, nil
+}
+
+// isDurationType reports whether the field type is a qualified Duration, like
+// time.Duration
+func isDurationType(fieldType string) bool {
+	qualifier, ok := strings.CutSuffix(fieldType, ".Duration")
+	return ok && token.IsIdentifier(qualifier)
+}
+
+// durationUnits are the units of durations from the largest to the smallest
+var durationUnits = []struct {
+	unit time.Duration
+	name string
+}{
+	{time.Hour, "Hour"},
+	{time.Minute, "Minute"},
+	{time.Second, "Second"},
+	{time.Millisecond, "Millisecond"},
+	{time.Microsecond, "Microsecond"},
+	{time.Nanosecond, "Nanosecond"},
+}
+
+// durationExpr returns a duration as a multiple of the largest unit that
+// divides it, such as 90 * time.Second. The units are qualified with the
+// given prefix.
+func durationExpr(d time.Duration, prefix string) string {
+	if d == 0 {
+		return "0"
+	}
+	for _, u := range durationUnits {
+		if d%u.unit != 0 {
+			continue
+		}
+		if n := d / u.unit; n != 1 {
+			return strconv.FormatInt(int64(n), 10) + " * " + prefix + u.name
+		}
+		return prefix + u.name
+	}
+	return strconv.FormatInt(int64(d), 10)
+}
+
+// zeroCond returns the condition that holds when expr is the zero value of the field type
+func zeroCond(expr string, f FieldInfo) string {
+	if f.Kind == KindBool {
+		return "!" + expr
+	}
+	return expr + " == " + zeroValue(f)
+}
+
+// nonZeroCond returns the condition that holds when expr isn't the zero value of the field type
+func nonZeroCond(expr string, f FieldInfo) string {
+	if f.Kind == KindBool {
+		return expr
+	}
+	return expr + " != " + zeroValue(f)
+}
+
+// zeroValue returns the zero value of the field type as a Go expression
+func zeroValue(f FieldInfo) string {
+	switch {
+	case f.Kind.Nilable():
+		return "nil"
+	case f.Kind == KindString:
+		return `""`
+	case f.Kind == KindNumber:
+		return "0"
+	case f.Kind == KindBool:
+		return "false"
+	case f.Kind == KindStruct || f.Kind == KindArray:
+		return "(" + f.Type + "{})"
+	default:
+		return "*new(" + f.Type + ")"
+	}
+}
+
+// hasRule reports whether the rules contain one with the given name
+func hasRule(rules []Rule, name string) bool {
+	for _, rule := range rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// upperFirst returns s with its first letter in upper case
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// lowerFirst returns s with its first letter in lower case
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
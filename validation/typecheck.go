@@ -0,0 +1,154 @@
+package validation
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseDir parses the source files of the package in the given directory,
+// skipping tests, generated code, files excluded by build constraints and the
+// given paths
+func parseDir(fset *token.FileSet, dir string, exclude ...string) ([]*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading package directory: %w", err)
+	}
+
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if isExcluded(path, exclude) {
+			continue
+		}
+		if match, err := build.Default.MatchFile(dir, name); err != nil || !match {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("parsing file: %w", err)
+		}
+		if ast.IsGenerated(file) {
+			continue
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// isExcluded reports whether path refers to one of the excluded files
+func isExcluded(path string, exclude []string) bool {
+	for _, other := range exclude {
+		if sameFile(path, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPackage type-checks the files of the given package. Files of other
+// packages in the same directory are ignored. Type errors are tolerated, since
+// the package usually references code that has not been generated yet.
+func checkPackage(fset *token.FileSet, pkgName string, files []*ast.File) *types.Info {
+	var pkgFiles []*ast.File
+	for _, file := range files {
+		if file.Name.Name == pkgName {
+			pkgFiles = append(pkgFiles, file)
+		}
+	}
+
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	// The returned error is the first type error, which is ignored on purpose
+	_, _ = conf.Check(pkgName, fset, pkgFiles, info)
+
+	return info
+}
+
+// checkArrayLens verifies that the lengths of the array types in the given
+// type expression are constants
+func checkArrayLens(expr ast.Expr, info *types.Info) error {
+	var err error
+	ast.Inspect(expr, func(n ast.Node) bool {
+		array, ok := n.(*ast.ArrayType)
+		if !ok || array.Len == nil || err != nil {
+			return err == nil
+		}
+		if tv, ok := info.Types[array.Len]; !ok || tv.Value == nil {
+			err = fmt.Errorf("array length %s is not a constant", types.ExprString(array.Len))
+		}
+		return err == nil
+	})
+	return err
+}
+
+// sameFile reports whether both paths refer to the same file
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// kindOfType returns the kind of a resolved type
+func kindOfType(t types.Type) FieldKind {
+	// Type parameters have an interface as underlying type, but their values
+	// can't be compared to nil
+	if _, ok := t.(*types.TypeParam); ok {
+		return KindValue
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Kind() == types.UnsafePointer:
+			return KindPointer
+		case u.Info()&types.IsString != 0:
+			return KindString
+		case u.Info()&types.IsNumeric != 0:
+			return KindNumber
+		case u.Info()&types.IsBoolean != 0:
+			return KindBool
+		default:
+			return KindValue
+		}
+	case *types.Struct:
+		return KindStruct
+	case *types.Array:
+		return KindArray
+	case *types.Pointer:
+		return KindPointer
+	case *types.Interface:
+		return KindInterface
+	case *types.Map:
+		return KindMap
+	case *types.Slice:
+		return KindSlice
+	case *types.Signature:
+		return KindFunc
+	case *types.Chan:
+		return KindChan
+	default:
+		return KindValue
+	}
+}
@@ -0,0 +1,267 @@
+package validation
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// extractTypeParams extracts the type parameters from a type parameter list,
+// keeping names that share a constraint together, and the type arguments that
+// instantiate the type with its own parameters
+func extractTypeParams(typeParams *ast.FieldList) (string, string, error) {
+	var groups, names []string
+	for _, param := range typeParams.List {
+		constraint, err := extractType(param.Type)
+		if err != nil {
+			return "", "", err
+		}
+		var group []string
+		for _, name := range param.Names {
+			group = append(group, name.Name)
+		}
+		groups = append(groups, strings.Join(group, ", ")+" "+constraint)
+		names = append(names, group...)
+	}
+
+	// A single parameter constrained by a pointer type, such as [T *int],
+	// would be parsed as an array length in a type declaration
+	params := strings.Join(groups, ", ")
+	if len(names) == 1 && startsWithStar(typeParams.List[0].Type) {
+		params += ","
+	}
+
+	return "[" + params + "]", "[" + strings.Join(names, ", ") + "]", nil
+}
+
+// startsWithStar reports whether a constraint starts with a pointer type
+func startsWithStar(expr ast.Expr) bool {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return true
+	case *ast.BinaryExpr:
+		return startsWithStar(t.X)
+	default:
+		return false
+	}
+}
+
+// extractType extracts the type string from an AST expression. It returns an
+// error for expressions that aren't valid types.
+func extractType(expr ast.Expr) (string, error) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name, nil
+	case *ast.SelectorExpr:
+		pkg, ok := t.X.(*ast.Ident)
+		if !ok {
+			return "", fmt.Errorf("unsupported qualified type with %T as package", t.X)
+		}
+		return pkg.Name + "." + t.Sel.Name, nil
+	case *ast.StarExpr:
+		return prefixType("*", t.X)
+	case *ast.ParenExpr:
+		inner, err := extractType(t.X)
+		if err != nil {
+			return "", err
+		}
+		return "(" + inner + ")", nil
+	case *ast.Ellipsis:
+		return prefixType("...", t.Elt)
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return prefixType("[]", t.Elt)
+		}
+		length, err := extractArrayLen(t.Len)
+		if err != nil {
+			return "", err
+		}
+		return prefixType("["+length+"]", t.Elt)
+	case *ast.MapType:
+		key, err := extractType(t.Key)
+		if err != nil {
+			return "", err
+		}
+		return prefixType("map["+key+"]", t.Value)
+	case *ast.ChanType:
+		return extractChanType(t)
+	case *ast.FuncType:
+		signature, err := extractSignature(t)
+		if err != nil {
+			return "", err
+		}
+		return "func" + signature, nil
+	case *ast.StructType:
+		return extractStructType(t)
+	case *ast.InterfaceType:
+		return extractInterfaceType(t)
+	case *ast.UnaryExpr:
+		// Approximation elements of type unions, such as ~int
+		return prefixType(t.Op.String(), t.X)
+	case *ast.BinaryExpr:
+		// Type unions, such as ~int | ~string
+		x, err := extractType(t.X)
+		if err != nil {
+			return "", err
+		}
+		y, err := extractType(t.Y)
+		if err != nil {
+			return "", err
+		}
+		return x + " " + t.Op.String() + " " + y, nil
+	case *ast.IndexExpr:
+		return extractIndexedType(t.X, []ast.Expr{t.Index})
+	case *ast.IndexListExpr:
+		return extractIndexedType(t.X, t.Indices)
+	default:
+		return "", fmt.Errorf("unsupported type expression %T", expr)
+	}
+}
+
+// prefixType extracts the type string of expr with the given prefix
+func prefixType(prefix string, expr ast.Expr) (string, error) {
+	text, err := extractType(expr)
+	if err != nil {
+		return "", err
+	}
+	return prefix + text, nil
+}
+
+// extractIndexedType extracts the type string of a generic type instantiated
+// with the given type arguments
+func extractIndexedType(expr ast.Expr, indices []ast.Expr) (string, error) {
+	base, err := extractType(expr)
+	if err != nil {
+		return "", err
+	}
+	args := make([]string, 0, len(indices))
+	for _, index := range indices {
+		arg, err := extractType(index)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, arg)
+	}
+	return base + "[" + strings.Join(args, ", ") + "]", nil
+}
+
+// extractChanType extracts the type string of a channel, keeping its direction
+func extractChanType(t *ast.ChanType) (string, error) {
+	switch t.Dir {
+	case ast.SEND:
+		return prefixType("chan<- ", t.Value)
+	case ast.RECV:
+		return prefixType("<-chan ", t.Value)
+	}
+
+	// A bidirectional channel of receive-only channels needs parentheses,
+	// since chan <-chan T would be parsed as a send-only channel
+	if value, ok := t.Value.(*ast.ChanType); ok && value.Dir == ast.RECV {
+		inner, err := extractType(t.Value)
+		if err != nil {
+			return "", err
+		}
+		return "chan (" + inner + ")", nil
+	}
+	return prefixType("chan ", t.Value)
+}
+
+// extractSignature extracts the parameters and results of a function type
+func extractSignature(t *ast.FuncType) (string, error) {
+	params, err := extractFieldList(t.Params, ", ")
+	if err != nil {
+		return "", err
+	}
+	params = "(" + params + ")"
+	if t.Results == nil || len(t.Results.List) == 0 {
+		return params, nil
+	}
+
+	// A single unnamed result doesn't need parentheses
+	if len(t.Results.List) == 1 && len(t.Results.List[0].Names) == 0 {
+		return prefixType(params+" ", t.Results.List[0].Type)
+	}
+	results, err := extractFieldList(t.Results, ", ")
+	if err != nil {
+		return "", err
+	}
+	return params + " (" + results + ")", nil
+}
+
+// extractStructType extracts the type string of an anonymous struct, keeping
+// the tags of its fields
+func extractStructType(t *ast.StructType) (string, error) {
+	if t.Fields == nil || len(t.Fields.List) == 0 {
+		return "struct{}", nil
+	}
+	fields, err := extractFieldList(t.Fields, "; ")
+	if err != nil {
+		return "", err
+	}
+	return "struct{ " + fields + " }", nil
+}
+
+// extractInterfaceType extracts the type string of an interface, with its
+// methods, embedded interfaces and type unions
+func extractInterfaceType(t *ast.InterfaceType) (string, error) {
+	if t.Methods == nil || len(t.Methods.List) == 0 {
+		return "interface{}", nil
+	}
+
+	var elems []string
+	for _, method := range t.Methods.List {
+		var elem string
+		var err error
+		if funcType, ok := method.Type.(*ast.FuncType); ok && len(method.Names) > 0 {
+			elem, err = extractSignature(funcType)
+			elem = method.Names[0].Name + elem
+		} else {
+			elem, err = extractType(method.Type)
+		}
+		if err != nil {
+			return "", err
+		}
+		elems = append(elems, elem)
+	}
+	return "interface{ " + strings.Join(elems, "; ") + " }", nil
+}
+
+// extractFieldList extracts the fields of a parameter list or struct type,
+// joined by sep. Names that share a type are kept together.
+func extractFieldList(list *ast.FieldList, sep string) (string, error) {
+	if list == nil {
+		return "", nil
+	}
+
+	var fields []string
+	for _, field := range list.List {
+		var names []string
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+
+		text, err := extractType(field.Type)
+		if err != nil {
+			return "", err
+		}
+		if len(names) > 0 {
+			text = strings.Join(names, ", ") + " " + text
+		}
+		if field.Tag != nil {
+			text += " " + field.Tag.Value
+		}
+		fields = append(fields, text)
+	}
+	return strings.Join(fields, sep), nil
+}
+
+// extractArrayLen extracts the length of an array from an AST expression.
+// Constants and constant expressions are kept verbatim, since they can only be
+// evaluated with type information.
+func extractArrayLen(expr ast.Expr) (string, error) {
+	if _, ok := expr.(*ast.Ellipsis); ok {
+		return "", fmt.Errorf("array length [...] is only allowed in composite literals")
+	}
+	return types.ExprString(expr), nil
+}
@@ -0,0 +1,115 @@
+package validation
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestExtractType(t *testing.T) {
+	tests := []string{
+		"int",
+		"*http.Client",
+		"[]string",
+		"[4]int",
+		"[MaxShards]Shard",
+		"[shards.Max]Shard",
+		"[2 * N]byte",
+		"[len(Names)]string",
+		"map[string][]*Event",
+		"Repository[T]",
+		"Store[K, V]",
+		"func()",
+		"func(error)",
+		"func(a, b int) bool",
+		"func(format string, args ...any) (n int, err error)",
+		"func(context.Context) (T, error)",
+		"chan Event",
+		"chan<- Event",
+		"<-chan Event",
+		"chan (<-chan int)",
+		"struct{}",
+		"struct{ X, Y int; Name string `json:\"name\"`; *Base }",
+		"interface{}",
+		"interface{ Close() error; io.Reader }",
+		"interface{ ~int | ~string; String() string }",
+		"(*Event)",
+	}
+
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			expr, err := parser.ParseExpr(src)
+			if err != nil {
+				t.Fatalf("Failed to parse %s: %v", src, err)
+			}
+
+			got, err := extractType(expr)
+			if err != nil {
+				t.Fatalf("extractType() failed: %v", err)
+			}
+			if got != src {
+				t.Errorf("extractType() = %s, want %s", got, src)
+			}
+		})
+	}
+}
+
+func TestExtractTypeErrors(t *testing.T) {
+	tests := []string{
+		"newClient().Client",
+		"Store[1 + 2]",
+		"map[string]func() x.y.Z",
+	}
+
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			expr, err := parser.ParseExpr(src)
+			if err != nil {
+				t.Fatalf("Failed to parse %s: %v", src, err)
+			}
+
+			if got, err := extractType(expr); err == nil {
+				t.Errorf("extractType() = %s, want an error", got)
+			}
+		})
+	}
+}
+
+func TestExtractTypeParams(t *testing.T) {
+	tests := []struct {
+		params string
+		args   string
+	}{
+		{"[T any]", "[T]"},
+		{"[K comparable, V any]", "[K, V]"},
+		{"[K, V comparable]", "[K, V]"},
+		{"[N ~int | ~int64]", "[N]"},
+		{"[T interface{ ~string; Len() int }]", "[T]"},
+		{"[M ~map[K][]V, K comparable, V fmt.Stringer]", "[M, K, V]"},
+		{"[S ~[]E, E Store[K, V], K, V any]", "[S, E, K, V]"},
+		{"[T *int,]", "[T]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.params, func(t *testing.T) {
+			src := "package test\n\ntype Test" + tt.params + " struct{}\n"
+			file, err := parser.ParseFile(token.NewFileSet(), "test.go", src, 0)
+			if err != nil {
+				t.Fatalf("Failed to parse %s: %v", tt.params, err)
+			}
+			typeSpec := file.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec)
+
+			params, args, err := extractTypeParams(typeSpec.TypeParams)
+			if err != nil {
+				t.Fatalf("extractTypeParams() failed: %v", err)
+			}
+			if params != tt.params {
+				t.Errorf("extractTypeParams() params = %s, want %s", params, tt.params)
+			}
+			if args != tt.args {
+				t.Errorf("extractTypeParams() args = %s, want %s", args, tt.args)
+			}
+		})
+	}
+}